@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	purgeKeys      bool
+	prefillFormats []string
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "inspect and purge the server's render cache",
+		Long: `Diagrams are looked up the same way "pml render" sends them, so pass the same
+--format, --layout, and --plantuml-version.
+
+Purging removes renders from every groupcache peer, and the disk caches of
+servers that get the purge.
+
+Lookups, purges, stats, and prefills go to the server's admin listener, its --admin-addr.
+`,
+		Example: `
+pml cache lookup diagram.puml --format svg --admin-addr localhost:6060
+pml cache purge diagram.puml --format svg --admin-addr localhost:6060
+pml cache purge --key 3f2a... --admin-addr localhost:6060
+pml cache stats --admin-addr localhost:6060
+pml cache prefill docs/architecture --format svg --admin-addr localhost:6060
+`,
+	}
+	rootCmd.AddCommand(cmd)
+
+	lookup := &cobra.Command{
+		Use:   "lookup [file|shortcode]",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   cacheLookupRun,
+		Short: "show whether a diagram is cached, and by which peer",
+	}
+	cmd.AddCommand(lookup)
+
+	purge := &cobra.Command{
+		Use:   "purge [file|shortcode|key...]",
+		Run:   cachePurgeRun,
+		Short: "remove a diagram's render from the cache, read from stdin if no file is provided",
+	}
+	purge.Flags().BoolVar(&purgeKeys, "key", false, "arguments are cache keys, as printed by lookup")
+	cmd.AddCommand(purge)
+
+	for _, c := range []*cobra.Command{lookup, purge} {
+		c.Flags().StringVarP(&renderFormat, "format", "f", "png", "format the diagram was rendered as")
+		addRequestFlags(c.Flags())
+		addAdminFlags(c.Flags())
+	}
+
+	stats := &cobra.Command{
+		Use:   "stats",
+		Args:  cobra.ExactArgs(0),
+		Run:   cacheStatsRun,
+		Short: "print hit rates and sizes of the server's caches",
+	}
+	addAdminFlags(stats.Flags())
+	cmd.AddCommand(stats)
+
+	prefill := &cobra.Command{
+		Use:   "prefill [path]",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   cachePrefillRun,
+		Short: "render diagrams from the server's --prefill directory into the cache, or only path within it",
+	}
+	prefill.Flags().StringSliceVarP(&prefillFormats, "format", "f", []string{}, "formats to render .puml files as (default: the server's --prefill-format)")
+	addAdminFlags(prefill.Flags())
+	cmd.AddCommand(prefill)
+}
+
+func cacheLookupRun(cmd *cobra.Command, args []string) {
+	req := renderRequest(args)
+
+	client, err := getAdminClient()
+	if err != nil {
+		fatalf("unable to connect to server: %v", err)
+	}
+	resp, err := client.LookupCache(context.Background(), &pb.LookupCacheRequest{Request: req})
+	if err != nil {
+		fatalf("unexpected failure: %v\n", err)
+	}
+	owner := resp.Owner
+	if owner == "" {
+		owner = "self"
+	}
+	fmt.Printf("key:     %s\n", resp.Key)
+	fmt.Printf("cached:  %v\n", resp.Cached)
+	fmt.Printf("on disk: %v\n", resp.OnDisk)
+	fmt.Printf("owner:   %s\n", owner)
+}
+
+func cachePurgeRun(cmd *cobra.Command, args []string) {
+	purge := &pb.PurgeCacheRequest{}
+	if purgeKeys {
+		if len(args) == 0 {
+			fatalfUsage(cmd, "must give at least one key")
+		}
+		purge.Keys = args
+	} else {
+		if len(args) > 1 {
+			fatalfUsage(cmd, "only one diagram can be purged at a time, unless using --key")
+		}
+		purge.Requests = []*pb.RenderRequest{renderRequest(args)}
+	}
+
+	client, err := getAdminClient()
+	if err != nil {
+		fatalf("unable to connect to server: %v", err)
+	}
+	resp, err := client.PurgeCache(context.Background(), purge)
+	if err != nil {
+		fatalf("unexpected failure: %v\n", err)
+	}
+	for _, key := range resp.Keys {
+		fmt.Println(key)
+	}
+}
+
+func cacheStatsRun(cmd *cobra.Command, args []string) {
+	client, err := getAdminClient()
+	if err != nil {
+		fatalf("unable to connect to server: %v", err)
+	}
+	resp, err := client.GetCacheStats(context.Background(), &pb.GetCacheStatsRequest{})
+	if err != nil {
+		fatalf("unexpected failure: %v\n", err)
+	}
+
+	if g := resp.Group; g != nil {
+		fmt.Printf("group: gets=%d hits=%d loads=%d deduped=%d local=%d local_errors=%d peer=%d peer_errors=%d from_peers=%d\n",
+			g.Gets, g.CacheHits, g.Loads, g.LoadsDeduped, g.LocalLoads, g.LocalLoadErrors,
+			g.PeerLoads, g.PeerErrors, g.ServerRequests,
+		)
+	}
+	fmt.Println(strings.Join([]string{"cache", "items", "bytes", "gets", "hits", "evictions"}, "\t"))
+	for _, c := range resp.Caches {
+		fmt.Println(strings.Join([]string{
+			c.Name,
+			strconv.FormatInt(c.Items, 10),
+			strconv.FormatInt(c.Bytes, 10),
+			strconv.FormatInt(c.Gets, 10),
+			strconv.FormatInt(c.Hits, 10),
+			strconv.FormatInt(c.Evictions, 10),
+		}, "\t"))
+	}
+}
+
+func cachePrefillRun(cmd *cobra.Command, args []string) {
+	req := &pb.PrefillRequest{}
+	if len(args) > 0 {
+		req.Path = args[0]
+	}
+	for _, name := range prefillFormats {
+		f, ok := pb.Format_value[strings.ToUpper(name)]
+		if !ok {
+			fatalf("invalid format type: %s", name)
+		}
+		req.Formats = append(req.Formats, pb.Format(f))
+	}
+
+	client, err := getAdminClient()
+	if err != nil {
+		fatalf("unable to connect to server: %v", err)
+	}
+	resp, err := client.Prefill(context.Background(), req)
+	if err != nil {
+		fatalf("unexpected failure: %v\n", err)
+	}
+	fmt.Printf("rendered: %d\n", resp.Rendered)
+	fmt.Printf("cached:   %d\n", resp.Cached)
+	fmt.Printf("failed:   %d\n", resp.Failed)
+	fmt.Printf("skipped:  %d\n", resp.Skipped)
+}
@@ -53,10 +53,11 @@ func Execute() error {
 }
 
 var (
-	addr     string
-	insecure bool
-	errorC   = color.New(color.FgHiRed)
-	warningC = color.New(color.FgYellow)
+	addr            string
+	adminClientAddr string
+	insecure        bool
+	errorC          = color.New(color.FgHiRed)
+	warningC        = color.New(color.FgYellow)
 )
 
 func init() {
@@ -78,24 +79,42 @@ func normalizeFlags(f *pflag.FlagSet, name string) pflag.NormalizedName {
 }
 
 func getClient() (pb.PlantUMLClient, error) {
-	var conn grpc.ClientConnInterface
-	var err error
-	if !insecure {
-		certPool, err := x509.SystemCertPool()
-		if err != nil {
-			return nil, err
-		}
-		config := &tls.Config{RootCAs: certPool}
-		conn, err = grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(config)))
-	} else {
-		conn, err = grpc.Dial(addr, grpc.WithInsecure())
-	}
+	conn, err := dial(addr)
 	if err != nil {
 		return nil, err
 	}
 	return pb.NewPlantUMLClient(conn), nil
 }
 
+// addAdminFlags adds --admin-addr to commands that use getAdminClient
+func addAdminFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&adminClientAddr, "admin-addr", "", "the server's admin listener, its daemon --admin-addr (eg: localhost:6060)")
+}
+
+// getAdminClient connects to the Admin service on the server's admin listener
+func getAdminClient() (pb.AdminClient, error) {
+	if adminClientAddr == "" {
+		return nil, fmt.Errorf("--admin-addr is required, the admin service isn't served on --addr")
+	}
+	conn, err := dial(adminClientAddr)
+	if err != nil {
+		return nil, err
+	}
+	return pb.NewAdminClient(conn), nil
+}
+
+func dial(addr string) (grpc.ClientConnInterface, error) {
+	if insecure {
+		return grpc.Dial(addr, grpc.WithInsecure())
+	}
+	certPool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{RootCAs: certPool}
+	return grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+}
+
 func fatalf(f string, v ...interface{}) {
 	errorC.Fprintf(os.Stderr, f, v...)
 	os.Exit(1)
@@ -3,26 +3,67 @@ package cli
 import (
 	"context"
 	"flag"
-	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/coxley/pmlproxy/pb"
 	"github.com/coxley/pmlproxy/server"
-	"github.com/golang/groupcache"
+	"github.com/mailgun/groupcache/v2"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
 	"github.com/golang/glog"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
 	daemonPprof  string
+	adminAddr    string
 	cacheAddr    string
 	groupMembers []string
+	groupDNS     []string
+	groupFile    string
+	groupRefresh time.Duration
+	warmupFiles  []string
+	warmup       bool
+	upstreams    []string
+	upstreamWait time.Duration
+	httpAddr     string
+	versions     map[string]string
+
+	includeLibrary  bool
+	securityProfile string
+	allowPaths      []string
+	allowURLs       []string
+
+	cacheKind            string
+	cacheBytes           int64
+	cacheTTL             time.Duration
+	diskCacheDir         string
+	diskCacheBytes       int64
+	daemonPrefillFormats []string
+
+	traceFile   string
+	traceSample float64
+
+	logVerbosity int
 )
 
 var handler = server.DefaultHandler
@@ -37,66 +78,311 @@ func init() {
 	rootCmd.AddCommand(cmd)
 	flags := cmd.Flags()
 	flags.IntVar(&handler.Workers, "workers", handler.Workers, "number of plantuml processes used for rendering")
+	flags.IntVar(&handler.MinWorkers, "min-workers", handler.MinWorkers, "lower bound when autoscaling plantuml processes (default: --workers)")
+	flags.IntVar(&handler.MaxWorkers, "max-workers", handler.MaxWorkers, "upper bound when autoscaling plantuml processes (default: --workers)")
+	flags.DurationVar(&handler.ScaleUpWait, "scale-up-wait", handler.ScaleUpWait, "add a plantuml process when a request waits this long for one")
+	flags.DurationVar(&handler.ScaleDownIdle, "scale-down-idle", handler.ScaleDownIdle, "remove a plantuml process after it sits idle this long")
+	flags.IntVar(&handler.MaxQueue, "max-queue", handler.MaxQueue, "requests allowed to wait for a plantuml process before rejecting new ones (0 for unbounded)")
+	flags.IntVar(&handler.BreakerThreshold, "breaker-threshold", handler.BreakerThreshold, "consecutive plantuml start failures before failing requests fast (0 to disable)")
+	flags.DurationVar(&handler.BreakerCooldown, "breaker-cooldown", handler.BreakerCooldown, "how long to wait before retrying plantuml processes once the breaker trips")
 	flags.StringVar(&daemonPprof, "pprof", "", "enable pprof and listen on addr (eg: :6060")
+	flags.MarkDeprecated("pprof", "use --admin-addr, which also serves pprof")
+	flags.StringVar(&traceFile, "trace-file", "", "write opentelemetry spans as json lines to this file, or - for stdout (default: tracing off)")
+	flags.Float64Var(&traceSample, "trace-sample", 1, "fraction of requests to trace with --trace-file, unless the caller already decided")
+	flags.IntVarP(&logVerbosity, "verbosity", "v", 0, "log detail: 0 for lifecycle and errors, 1 adds a line per request, 2 adds cache and worker steps")
+	flags.BoolVar(&handler.LogDiagrams, "log-diagrams", false, "log diagrams as short codes at --verbosity=2 instead of a digest — they may contain anything users draw")
+	flags.StringVar(&adminAddr, "admin-addr", "", "serve /metrics, /healthz, /readyz, /debug/pprof, and a status page on addr (eg: :6060)")
 	flags.StringVar(&handler.JavaExe, "java-path", handler.JavaExe, "path to java")
-	flags.StringVar(&handler.PipeDelimiter, "pipe-delimiter", handler.PipeDelimiter, "used by plantuml to separate image results. only need to override if it may be found in your user's diagrams")
+	flags.StringVar(&handler.PipeDelimiter, "pipe-delimiter", handler.PipeDelimiter, "fixed string used by plantuml to separate image results (default: random per process, only set for debugging)")
 	flags.StringVar(&handler.PlantUMLPath, "plantuml-path", handler.PlantUMLPath, "path to plantuml jar")
+	flags.StringVar(&handler.GraphvizDot, "graphviz-dot", handler.GraphvizDot, "path to graphviz's dot — diagrams default to the smetana layout when it's missing (default: dot in $PATH)")
+	flags.StringToStringVar(&versions, "plantuml-version", map[string]string{}, "run another plantuml jar that requests can pick by name (eg: 1.2022.7=/opt/plantuml-1.2022.7.jar) — can specify multiple times, replaces --plantuml-path")
+	flags.StringVar(&handler.DefaultVersion, "default-plantuml-version", "", "version used when requests don't pick one (default: newest --plantuml-version)")
 	flags.StringVar(&handler.SearchPath, "search-path", handler.SearchPath, "path for plantuml to search for modules/themes that we create on start")
 	flags.DurationVar(&handler.RenderTimeout, "render-timeout", handler.RenderTimeout, "max time for server to wait on diagram rendering before killing the request")
+	flags.IntVar(&handler.MaxWorkerRenders, "max-worker-renders", handler.MaxWorkerRenders, "recycle a plantuml process after this many renders (0 to disable)")
+	flags.DurationVar(&handler.MaxWorkerAge, "max-worker-age", handler.MaxWorkerAge, "recycle a plantuml process after running this long (0 to disable)")
+	flags.BoolVar(&warmup, "warmup", true, "render warm-up diagrams in each plantuml process before accepting requests")
+	flags.StringSliceVar(&warmupFiles, "warmup-file", []string{}, "diagram to use for warm-up instead of the built-in ones — can specify multiple times")
+	flags.IntVar(&handler.MinReadyWorkers, "min-ready-workers", handler.MinReadyWorkers, "number of warm plantuml processes needed before reporting ready")
+	flags.Int64Var(&handler.MaxWorkerRSS, "max-worker-rss", handler.MaxWorkerRSS, "recycle a plantuml process once its resident memory crosses this many bytes (0 to disable)")
+
+	flags.BoolVar(&includeLibrary, "include-library", false, "keep files uploaded through --admin-addr in --search-path, that diagrams can !include <name> (see: pml include)")
+	flags.StringVar(&securityProfile, "security-profile", "", "sandbox diagram includes and set this plantuml security profile: UNSECURE, LEGACY, SANDBOX, ALLOWLIST, or INTERNET (default: no sandboxing, or ALLOWLIST with --allow-include-*)")
+	flags.StringSliceVar(&allowPaths, "allow-include-path", []string{}, "absolute directory diagrams may include files and images from, in addition to --search-path — can specify multiple times, but not /")
+	flags.StringSliceVar(&allowURLs, "allow-include-url", []string{}, "url prefix diagrams may include files and images from (eg: https://host/dir/) — can specify multiple times")
 
-	flags.StringVarP(&cacheAddr, "cache-addr", "c", "", "Enables groupcache and configures HTTP socket to listen on")
+	flags.StringSliceVar(&upstreams, "upstream", []string{}, "render with a remote plantuml-server or pmlproxy (eg: http://host:8080) instead of local java — can specify multiple times")
+	flags.DurationVar(&upstreamWait, "upstream-timeout", time.Second*10, "max time to wait on each upstream before trying the next")
+	flags.StringVar(&httpAddr, "http-addr", "", "serve renders over http using plantuml's encoded-url scheme (eg: :8080)")
+
+	flags.StringVar(&cacheKind, "cache", "group", "in-memory render cache: group (shared with --group-member peers), lru, or none")
+	flags.Int64Var(&cacheBytes, "cache-bytes", 10000000, "max size of the in-memory render cache")
+	flags.DurationVar(&cacheTTL, "cache-ttl", 0, "expire renders from the lru cache after this long (0 to keep until evicted)")
+	flags.BoolVar(&handler.AllowBypassCache, "allow-bypass-cache", false, "let clients skip the render cache with --bypass-cache — only for trusted clients, since uncached renders all reach the workers")
+	flags.StringVarP(&cacheAddr, "cache-addr", "c", "", "Enables groupcache and configures HTTP socket to listen on — it identifies this server, so with --group-dns or --group-file it must be the address peers see (not :port or 0.0.0.0)")
 	flags.StringSliceVarP(&groupMembers, "group-member", "g", []string{}, "other participant in the group cache — can specify multiple times")
+	flags.StringSliceVar(&groupDNS, "group-dns", []string{}, "discover group cache participants from dns: host:port for A records, or an SRV name starting with '_' — can specify multiple times")
+	flags.StringVar(&groupFile, "group-file", "", "discover group cache participants from a file with one host:port per line, re-read every --group-refresh")
+	flags.DurationVar(&groupRefresh, "group-refresh", time.Second*30, "how often to look up --group-dns and --group-file participants")
+	flags.StringVar(&diskCacheDir, "disk-cache-dir", "", "keep renders in this directory so the cache survives restarts (default: memory only)")
+	flags.Int64Var(&diskCacheBytes, "disk-cache-bytes", 1024*1024*1024, "max size of --disk-cache-dir before the least recently used renders are evicted")
+	flags.StringVar(&handler.PrefillDir, "prefill", "", "render .puml files and images with diagram text from this directory into the cache once workers are ready (see: pml cache prefill)")
+	flags.StringSliceVar(&daemonPrefillFormats, "prefill-format", []string{"png", "svg"}, "formats to render --prefill .puml files as — images are only rendered as their own")
+}
+
+func setupAdmin(addr string, h server.Handler, peers *server.PeerWatcher, flags *pflag.FlagSet) *http.Server {
+	config := map[string]string{}
+	flags.VisitAll(func(f *pflag.Flag) {
+		config[f.Name] = f.Value.String()
+	})
+	srv := http.Server{Addr: addr, Handler: server.AdminHandler(h, peers, config)}
+	go func() {
+		glog.Infof("starting admin server on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Fatal(err)
+		}
+	}()
+	return &srv
 }
 
-func setupPprof(addr string) {
-	glog.Infof("starting pprof server on %s", addr)
-	err := http.ListenAndServe(addr, nil)
+// setupTracing exports spans to path, returning a func that flushes them
+func setupTracing(path string, ratio float64) (func(), error) {
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(out))
 	if err != nil {
-		glog.Errorf("failed to start pprof server: %v", err)
+		return nil, err
 	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("pmlproxy"),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	glog.Infof("writing traces to %s", path)
+	return func() {
+		if err := provider.Shutdown(context.Background()); err != nil {
+			glog.Errorf("unable to flush traces: %v", err)
+		}
+		if out != os.Stdout {
+			out.Close()
+		}
+	}, nil
 }
 
-func setupCache(localAddr string, peers []string) *http.Server {
-	pool := groupcache.NewHTTPPoolOpts("http://"+localAddr, &groupcache.HTTPPoolOptions{})
-	var peerURLs []string
-	// for _, a := range append([]string{localAddr}, peers...) {
-	for _, a := range append(peers, localAddr) {
-		peerURLs = append(peerURLs, fmt.Sprintf("http://%s", a))
+func setupCache(ctx context.Context, localAddr string, cache *server.GroupCache) (*http.Server, *server.PeerWatcher) {
+	self := "http://" + localAddr
+	pool := groupcache.NewHTTPPoolOpts(self, server.CachePoolOptions())
+	cache.Pool = pool
+
+	sources := []server.PeerSource{server.StaticPeers(groupMembers)}
+	for _, name := range groupDNS {
+		sources = append(sources, server.DNSPeers{Name: name})
 	}
-	pool.Set(peerURLs...)
-	server := http.Server{Addr: localAddr, Handler: pool}
+	if groupFile != "" {
+		sources = append(sources, server.FilePeers{Path: groupFile})
+	}
+	watcher := &server.PeerWatcher{
+		Self:    self,
+		Sources: sources,
+		Set:     pool.Set,
+	}
+	if len(groupDNS) > 0 || groupFile != "" {
+		watcher.Interval = groupRefresh
+	}
+	// Once up-front so static peers are set before serving
+	watcher.Refresh(ctx)
+	go watcher.Run(ctx)
+
+	srv := http.Server{Addr: localAddr, Handler: server.CachePeerHandler(pool, handler.DiskCache)}
 	go func() {
-		glog.Infof("starting groupcache server with these peers: %v", peerURLs)
-		if err := server.ListenAndServe(); err != nil {
+		glog.Infof("starting groupcache server with these peers: %v", watcher.Peers())
+		if err := srv.ListenAndServe(); err != nil {
 			glog.Fatal(err)
 		}
 	}()
-	return &server
+	return &srv, watcher
+}
+
+func setupHTTP(addr string, h server.Handler) *http.Server {
+	srv := http.Server{Addr: addr, Handler: server.HTTPHandler(h)}
+	go func() {
+		glog.Infof("starting http render server on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Fatal(err)
+		}
+	}()
+	return &srv
 }
 
 func daemonRun(cmd *cobra.Command, args []string) {
 	// Call after handling everything else — and only in paths that use glog —
 	// because otherwise it overrides the --help docs
 	flag.Parse()
+	flag.Set("v", strconv.Itoa(logVerbosity))
+
+	if !warmup {
+		handler.WarmupDiagrams = nil
+	} else if len(warmupFiles) > 0 {
+		handler.WarmupDiagrams = nil
+		for _, name := range warmupFiles {
+			content, err := fileContents(name)
+			if err != nil {
+				glog.Fatalf("unable to read warm-up diagram %s: %v", name, err)
+			}
+			handler.WarmupDiagrams = append(handler.WarmupDiagrams, content)
+		}
+	}
 
-	if daemonPprof != "" {
-		go setupPprof(daemonPprof)
+	if err := os.MkdirAll(handler.SearchPath, 0755); err != nil {
+		glog.Fatalf("unable to create search path: %v", err)
+	}
+	if includeLibrary {
+		lib, err := server.NewIncludeLibrary(handler.SearchPath)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		handler.Library = lib
 	}
+
+	if securityProfile != "" || len(allowPaths) > 0 || len(allowURLs) > 0 {
+		// Workers run from the search path, so relative paths need to resolve
+		// from here first
+		searchPath, err := filepath.Abs(handler.SearchPath)
+		if err != nil {
+			glog.Fatalf("unable to resolve search path: %v", err)
+		}
+		handler.SearchPath = searchPath
+		handler.Security = &server.SecurityPolicy{
+			Profile:    securityProfile,
+			Paths:      append(allowPaths, searchPath),
+			URLs:       allowURLs,
+			IncludeDir: searchPath,
+		}
+		if err := handler.Security.Validate(); err != nil {
+			glog.Fatalf("unable to sandbox includes: %v", err)
+		}
+		glog.Infof("sandboxing diagram includes: paths=%v urls=%v", handler.Security.Paths, allowURLs)
+	}
+
+	if len(versions) > 0 {
+		handler.Versions = map[string]*server.WorkerPool{}
+		for name, path := range versions {
+			handler.Versions[name] = handler.WithPlantUML(path)
+		}
+	}
+	if name := handler.DefaultVersion; name != "" {
+		if len(versions) == 0 {
+			glog.Fatalf("--default-plantuml-version needs --plantuml-version")
+		}
+		if _, ok := versions[name]; !ok {
+			var names []string
+			for n := range versions {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			glog.Fatalf("unknown --default-plantuml-version %q, choose from: %s", name, strings.Join(names, ", "))
+		}
+	}
+
+	if len(upstreams) > 0 {
+		remote := server.NewRemoteRenderer(upstreams...)
+		remote.Timeout = upstreamWait
+		handler.Renderer = remote
+		glog.Infof("rendering with upstreams instead of local java: %v", upstreams)
+	}
+
+	if diskCacheDir != "" {
+		cache, err := server.NewDiskCache(diskCacheDir, diskCacheBytes)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		handler.DiskCache = cache
+	}
+
+	handler.PrefillFormats = nil
+	for _, name := range daemonPrefillFormats {
+		f, ok := pb.Format_value[strings.ToUpper(name)]
+		if !ok || f == int32(pb.Format_UNSPECIFIED) {
+			glog.Fatalf("invalid --prefill-format: %s", name)
+		}
+		handler.PrefillFormats = append(handler.PrefillFormats, pb.Format(f))
+	}
+
+	if traceFile != "" {
+		flush, err := setupTracing(traceFile, traceSample)
+		if err != nil {
+			glog.Fatalf("unable to set up tracing: %v", err)
+		}
+		defer flush()
+	}
+
+	groupCache := server.NewGroupCache("render", cacheBytes)
+	switch cacheKind {
+	case "group":
+		handler.Cache = groupCache
+	case "lru":
+		handler.Cache = server.NewLRUCache(cacheBytes, cacheTTL)
+	case "none":
+	default:
+		glog.Fatalf("unknown --cache %q, choose from: group, lru, none", cacheKind)
+	}
+	var peers *server.PeerWatcher
 	if cacheAddr != "" {
-		cacheSrv := setupCache(cacheAddr, groupMembers)
+		if cacheKind != "group" {
+			glog.Fatalf("--cache-addr needs --cache=group")
+		}
+		// Discovered peers list each other by address. If ours doesn't match
+		// theirs, every ring differs and we'd fetch our own keys over HTTP.
+		if len(groupDNS) > 0 || groupFile != "" {
+			if host, _, err := net.SplitHostPort(cacheAddr); err != nil || host == "" || net.ParseIP(host).IsUnspecified() {
+				glog.Fatalf("--cache-addr must be how peers see this server, eg. $POD_IP:9001, when using --group-dns or --group-file: got %q", cacheAddr)
+			}
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var cacheSrv *http.Server
+		cacheSrv, peers = setupCache(ctx, cacheAddr, groupCache)
 		defer cacheSrv.Shutdown(context.Background())
 	}
 
 	server.MakeGRPC = func() *grpc.Server {
-		s := grpc.NewServer()
+		s := grpc.NewServer(grpc.ChainUnaryInterceptor(
+			otelgrpc.UnaryServerInterceptor(),
+			server.RequestIDInterceptor,
+		))
 		reflection.Register(s)
 		return s
 	}
-	handler.GroupCache = true
 	srv := &server.Server{
 		Addr:    addr, // global flag
 		Handler: &handler,
 	}
+	if httpAddr != "" {
+		httpSrv := setupHTTP(httpAddr, &handler)
+		defer httpSrv.Shutdown(context.Background())
+	}
+	if adminAddr == "" {
+		adminAddr = daemonPprof
+	}
+	if adminAddr == "" && includeLibrary {
+		glog.Warningf("--include-library without --admin-addr, so files can't be uploaded with pml include")
+	}
+	if adminAddr != "" {
+		adminSrv := setupAdmin(adminAddr, &handler, peers, cmd.Flags())
+		defer adminSrv.Shutdown(context.Background())
+	}
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
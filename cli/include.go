@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	includeVersion     int64
+	includeAllVersions bool
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "include",
+		Short: "manage shared files that diagrams can !include by name",
+		Long: `Servers started with --include-library keep a versioned library of files, like
+themes and !procedure libraries, under their search path.
+
+Diagrams get the latest version with "!include <name>" or pin one with
+"!include <name@version>".
+
+Uploads and deletes go to the server's admin listener, its --admin-addr.
+`,
+		Example: `
+pml include put ourcorp/style style.puml --admin-addr localhost:6060
+pml include ls ourcorp/
+pml include get ourcorp/style --version 2
+pml include rm ourcorp/style --version 2 --admin-addr localhost:6060
+`,
+	}
+	rootCmd.AddCommand(cmd)
+
+	put := &cobra.Command{
+		Use:   "put name [file]",
+		Args:  cobra.RangeArgs(1, 2),
+		Run:   includePutRun,
+		Short: "upload a new version, read from stdin if no file is provided",
+	}
+	addAdminFlags(put.Flags())
+	cmd.AddCommand(put)
+
+	ls := &cobra.Command{
+		Use:   "ls [prefix]",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   includeListRun,
+		Short: "list the latest version of each file",
+	}
+	ls.Flags().BoolVarP(&includeAllVersions, "all", "a", false, "list every version")
+	cmd.AddCommand(ls)
+
+	get := &cobra.Command{
+		Use:   "get name",
+		Args:  cobra.ExactArgs(1),
+		Run:   includeGetRun,
+		Short: "print a file's contents",
+	}
+	get.Flags().Int64Var(&includeVersion, "version", 0, "version to print (default: latest)")
+	cmd.AddCommand(get)
+
+	rm := &cobra.Command{
+		Use:   "rm name",
+		Args:  cobra.ExactArgs(1),
+		Run:   includeDeleteRun,
+		Short: "delete a file",
+	}
+	rm.Flags().Int64Var(&includeVersion, "version", 0, "version to delete (default: all)")
+	addAdminFlags(rm.Flags())
+	cmd.AddCommand(rm)
+}
+
+func includePutRun(cmd *cobra.Command, args []string) {
+	var content []byte
+	var err error
+	if len(args) == 2 {
+		content, err = ioutil.ReadFile(args[1])
+	} else {
+		content, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fatalf("failed reading content: %v", err)
+	}
+
+	client, err := getAdminClient()
+	if err != nil {
+		fatalf("unable to connect to server: %v", err)
+	}
+	resp, err := client.PutInclude(context.Background(), &pb.PutIncludeRequest{Name: args[0], Content: content})
+	if err != nil {
+		fatalf("unexpected failure: %v\n", err)
+	}
+	fmt.Printf("%s@%d\n", resp.File.Name, resp.File.Version)
+}
+
+func includeListRun(cmd *cobra.Command, args []string) {
+	var prefix string
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+
+	client, err := getClient()
+	if err != nil {
+		fatalf("unable to connect to server: %v", err)
+	}
+	resp, err := client.ListIncludes(context.Background(), &pb.ListIncludesRequest{
+		Prefix:      prefix,
+		AllVersions: includeAllVersions,
+	})
+	if err != nil {
+		fatalf("unexpected failure: %v\n", err)
+	}
+	for _, f := range resp.Files {
+		fmt.Println(strings.Join([]string{
+			f.Name + "@" + strconv.FormatInt(f.Version, 10),
+			strconv.FormatInt(f.Size, 10),
+			time.Unix(f.CreatedUnix, 0).Format(time.RFC3339),
+			f.Sha256[:12],
+		}, "\t"))
+	}
+}
+
+func includeGetRun(cmd *cobra.Command, args []string) {
+	client, err := getClient()
+	if err != nil {
+		fatalf("unable to connect to server: %v", err)
+	}
+	resp, err := client.GetInclude(context.Background(), &pb.GetIncludeRequest{Name: args[0], Version: includeVersion})
+	if err != nil {
+		fatalf("unexpected failure: %v\n", err)
+	}
+	os.Stdout.Write(resp.Content)
+}
+
+func includeDeleteRun(cmd *cobra.Command, args []string) {
+	client, err := getAdminClient()
+	if err != nil {
+		fatalf("unable to connect to server: %v", err)
+	}
+	_, err = client.DeleteInclude(context.Background(), &pb.DeleteIncludeRequest{Name: args[0], Version: includeVersion})
+	if err != nil {
+		fatalf("unexpected failure: %v\n", err)
+	}
+}
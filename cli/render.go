@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/coxley/pmlproxy/pb"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -18,8 +21,14 @@ var (
 	renderOutputToDisk bool
 	renderOutputFname  string = "diagram"
 	renderOutputSep    string = "---PMLPROXY---"
+	renderVersion      string
+	renderLayout       string
+	renderSendIncludes bool = true
+	renderBypassCache  bool
 )
 
+var includeLine = regexp.MustCompile(`^\s*!include\w*\s+"?([^<!"\s][^!"\s]*)`)
+
 func init() {
 	cmd := &cobra.Command{
 		Use:   "render [file|shortcode]",
@@ -64,7 +73,15 @@ pml extract diagram-0.png
 	flags.BoolVarP(&renderOutputToDisk, "output-to-disk", "o", renderOutputToDisk, "writes diagram(s) to disk when set")
 	flags.StringVarP(&renderOutputFname, "output-name", "n", renderOutputFname, "name of files to write, sans ext — appended with ordered numbers if multiple diagrams in source")
 	flags.StringVar(&renderOutputSep, "sep", renderOutputSep, "string to write between multiple diagrams when not writing to disk")
+	flags.BoolVar(&renderBypassCache, "bypass-cache", false, "render fresh instead of using the server's cache, eg. to debug stale output — the server must allow it")
+	addRequestFlags(flags)
+}
 
+// addRequestFlags adds the flags renderRequest uses, besides format
+func addRequestFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&renderSendIncludes, "send-includes", renderSendIncludes, "send files the diagram includes by relative path along with it")
+	flags.StringVar(&renderLayout, "layout", "", "layout engine: graphviz, smetana, or elk (default: graphviz if the server has it)")
+	flags.StringVar(&renderVersion, "plantuml-version", "", "plantuml version to render with, if the server has several (default: newest)")
 }
 
 func getFormatOptions() string {
@@ -78,14 +95,20 @@ func getFormatOptions() string {
 	return opts
 }
 
-func renderRun(cmd *cobra.Command, args []string) {
+// renderRequest builds a request from the render flags and a file, shortcode,
+// or stdin
+func renderRequest(args []string) *pb.RenderRequest {
 	diagram := pb.Diagram{}
+	var files map[string]string
 
 	// Work out where to get input from
 	if len(args) == 1 {
 		content, err := fileContents(args[0])
 		if err == nil {
 			diagram.Full = content
+			if renderSendIncludes {
+				files = collectIncludes(args[0], content)
+			}
 		} else if err == ErrFileNoExist {
 			// Assume shortcode
 			diagram.Short = args[0]
@@ -110,7 +133,26 @@ func renderRun(cmd *cobra.Command, args []string) {
 		fatalf("invalid format type: %s", renderFormat)
 	}
 	format := pb.Format(pb.Format_value[strings.ToUpper(renderFormat)])
-	req := &pb.RenderRequest{Diagram: &diagram, Format: format}
+	layout := pb.Layout_DEFAULT_LAYOUT
+	if renderLayout != "" {
+		l, ok := pb.Layout_value[strings.ToUpper(renderLayout)]
+		if !ok {
+			fatalf("invalid layout: %s", renderLayout)
+		}
+		layout = pb.Layout(l)
+	}
+	return &pb.RenderRequest{
+		Diagram:     &diagram,
+		Format:      format,
+		Version:     renderVersion,
+		Layout:      layout,
+		Files:       files,
+		BypassCache: renderBypassCache,
+	}
+}
+
+func renderRun(cmd *cobra.Command, args []string) {
+	req := renderRequest(args)
 
 	client, err := getClient()
 	if err != nil {
@@ -159,3 +201,40 @@ func fileContents(name string) (string, error) {
 	}
 	return string(content), nil
 }
+
+// collectIncludes reads files a diagram includes by relative path, recursively
+//
+// Names are relative to the diagram's directory. Includes outside of it, or
+// that don't exist locally, are left for the server to resolve.
+func collectIncludes(diagramPath, content string) map[string]string {
+	root := filepath.Dir(diagramPath)
+	files := map[string]string{}
+
+	var walk func(dir, content string)
+	walk = func(dir, content string) {
+		for _, line := range strings.Split(content, "\n") {
+			m := includeLine.FindStringSubmatch(line)
+			if m == nil || strings.Contains(m[1], "://") || filepath.IsAbs(m[1]) {
+				continue
+			}
+			path := filepath.Join(dir, m[1])
+			name, err := filepath.Rel(root, path)
+			if err != nil || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+				warningf("not sending %s, it's outside of %s\n", m[1], root)
+				continue
+			}
+			name = filepath.ToSlash(name)
+			if _, ok := files[name]; ok {
+				continue
+			}
+			included, err := fileContents(path)
+			if err != nil {
+				continue
+			}
+			files[name] = included
+			walk(filepath.Dir(path), included)
+		}
+	}
+	walk(root, content)
+	return files
+}
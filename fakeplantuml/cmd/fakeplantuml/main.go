@@ -0,0 +1,15 @@
+// Command fakeplantuml stands in for "java -jar plantuml.jar -pipe"
+//
+// Point pmlproxy at it with --java-path, and an empty --plantuml-path, to run
+// without Java installed.
+package main
+
+import (
+	"os"
+
+	"github.com/coxley/pmlproxy/fakeplantuml"
+)
+
+func main() {
+	os.Exit(fakeplantuml.Main(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
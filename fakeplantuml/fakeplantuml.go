@@ -0,0 +1,244 @@
+// Package fakeplantuml imitates PlantUML's -pipe mode for hermetic testing
+//
+// It speaks just enough of the protocol for pmlproxy's workers: diagrams are
+// read from stdin, each optionally preceded by "@@@format svg|png", and every
+// @startXYZ/@endXYZ pair is answered with an image followed by the pipe
+// delimiter and a newline.
+//
+// Images are deterministic and embed the diagram text the same way PlantUML
+// does, so extracting it works. They also carry a description of how they
+// were made:
+//
+//	fakeplantuml pid=<pid> format=<svg|png> page=<n> render=<n> version=<v>
+//
+// Behaviour is controlled by comments in the diagram text:
+//
+//	' fake: sleep 2s   wait before responding
+//	' fake: crash      exit without responding
+//	' fake: hang       never respond
+//	' fake: error      respond with an error image, like a syntax error
+//
+// And by extra command-line arguments:
+//
+//	-fake-fail-start           exit immediately, like a bad jar path
+//	-fake-startup-delay <dur>  wait before reading stdin, like a cold JVM
+//	-fake-version <v>          report a version other than Version
+//
+// Everything else on the command-line is accepted and ignored, so it can
+// stand in for "java" with pmlproxy's default worker arguments.
+package fakeplantuml
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Version is reported in image metadata, like PlantUML's own
+const Version = "1.2022.0(fake)"
+
+// Main runs the fake process, returning its exit code
+func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var delim string
+	version := Version
+	var startupDelay time.Duration
+	var pipe bool
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-pipe":
+			pipe = true
+		case "-pipedelimitor":
+			if i+1 < len(args) {
+				delim = args[i+1]
+				i++
+			}
+		case "-fake-version":
+			if i+1 < len(args) {
+				version = args[i+1]
+				i++
+			}
+		case "-fake-fail-start":
+			fmt.Fprintln(stderr, "Error: Unable to access jarfile (fakeplantuml)")
+			return 1
+		case "-fake-startup-delay":
+			if i+1 < len(args) {
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil {
+					fmt.Fprintf(stderr, "invalid -fake-startup-delay: %v\n", err)
+					return 1
+				}
+				startupDelay = d
+				i++
+			}
+		}
+	}
+	if !pipe {
+		fmt.Fprintln(stderr, "fakeplantuml only supports -pipe")
+		return 1
+	}
+	time.Sleep(startupDelay)
+
+	out := bufio.NewWriter(stdout)
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	format := "png"
+	var cur []string
+	var renders, page int
+	for scanner.Scan() {
+		line := scanner.Text()
+		if cur == nil {
+			if f := strings.TrimPrefix(line, "@@@format "); f != line {
+				format = strings.TrimSpace(f)
+				page = 0
+				continue
+			}
+			if !strings.HasPrefix(line, "@start") {
+				continue
+			}
+		}
+		cur = append(cur, line)
+		if !strings.HasPrefix(line, "@end") {
+			continue
+		}
+
+		text := strings.Join(cur, "\n")
+		cur = nil
+		renders++
+		page++
+
+		errorImage := false
+		for _, d := range directives(text) {
+			switch {
+			case d == "crash":
+				return 2
+			case d == "hang":
+				select {}
+			case d == "error":
+				errorImage = true
+			case strings.HasPrefix(d, "sleep "):
+				if dur, err := time.ParseDuration(strings.TrimPrefix(d, "sleep ")); err == nil {
+					time.Sleep(dur)
+				}
+			}
+		}
+
+		desc := fmt.Sprintf(
+			"fakeplantuml pid=%d format=%s page=%d render=%d version=%s",
+			os.Getpid(), format, page, renders, version,
+		)
+		if errorImage {
+			desc += " error=syntax"
+		}
+
+		var img []byte
+		switch format {
+		case "svg":
+			img = SVG(text, version, desc)
+		default:
+			img = PNG(text, version, desc)
+		}
+		out.Write(img)
+		fmt.Fprintf(out, "%s\n", delim)
+		out.Flush()
+	}
+	return 0
+}
+
+// directives returns the instructions in "' fake: ..." comments
+func directives(text string) []string {
+	var res []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if d := strings.TrimPrefix(line, "' fake:"); d != line {
+			res = append(res, strings.TrimSpace(d))
+		}
+	}
+	return res
+}
+
+// metadata is what PlantUML embeds in images: the source, then its version
+func metadata(text, version string) string {
+	return text + "\n\nPlantUML version " + version + "\n"
+}
+
+// SVG returns an image shaped like PlantUML's, with desc as its only text
+func SVG(text, version, desc string) []byte {
+	// Comments can't contain "--", so PlantUML spaces them out
+	comment := metadata(text, version)
+	for strings.Contains(comment, "--") {
+		comment = strings.ReplaceAll(comment, "--", "- -")
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>`)
+	b.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="200" height="20">`)
+	b.WriteString(`<g><text x="0" y="15">`)
+	xmlEscape(&b, desc)
+	b.WriteString(`</text><!--MD5=[00000000000000000000000000000000]` + "\n")
+	b.WriteString(comment)
+	b.WriteString(`--></g></svg>`)
+	return b.Bytes()
+}
+
+func xmlEscape(b *bytes.Buffer, s string) {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	r.WriteString(b, s)
+}
+
+// PNG returns a 1x1 image with the diagram in a plantuml iTXt chunk, and desc
+// in a tEXt chunk
+func PNG(text, version, desc string) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x89PNG\r\n\x1a\n")
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], 1) // width
+	binary.BigEndian.PutUint32(ihdr[4:], 1) // height
+	ihdr[8] = 8                             // bit depth
+	ihdr[9] = 0                             // grayscale
+	writeChunk(&b, "IHDR", ihdr)
+
+	// keyword, null, compression flag, method, empty language, empty translation
+	var itxt bytes.Buffer
+	itxt.WriteString("plantuml\x00\x01\x00\x00\x00")
+	zw := zlib.NewWriter(&itxt)
+	zw.Write([]byte(metadata(text, version)))
+	zw.Close()
+	writeChunk(&b, "iTXt", itxt.Bytes())
+
+	writeChunk(&b, "tEXt", []byte("fakeplantuml\x00"+desc))
+
+	// One filter byte and one grayscale pixel
+	var idat bytes.Buffer
+	zw = zlib.NewWriter(&idat)
+	zw.Write([]byte{0, 0xff})
+	zw.Close()
+	writeChunk(&b, "IDAT", idat.Bytes())
+
+	writeChunk(&b, "IEND", nil)
+	return b.Bytes()
+}
+
+func writeChunk(b *bytes.Buffer, ctype string, data []byte) {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(data)))
+	b.Write(length)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(ctype))
+	crc.Write(data)
+	b.WriteString(ctype)
+	b.Write(data)
+
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc.Sum32())
+	b.Write(sum)
+}
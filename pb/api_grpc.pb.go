@@ -32,6 +32,13 @@ type PlantUMLClient interface {
 	// NOTE: Whitespace isn't guaranteed to be stable so the encoded result
 	// before -> after may differ.
 	Extract(ctx context.Context, in *ExtractRequest, opts ...grpc.CallOption) (*ExtractResponse, error)
+	// Read shared files that diagrams can !include by name
+	//
+	// Every upload with new content is kept as a new version. Diagrams get
+	// the latest with "!include <name>", or pin one with "!include <name@3>".
+	// Uploads go through the Admin service.
+	GetInclude(ctx context.Context, in *GetIncludeRequest, opts ...grpc.CallOption) (*GetIncludeResponse, error)
+	ListIncludes(ctx context.Context, in *ListIncludesRequest, opts ...grpc.CallOption) (*ListIncludesResponse, error)
 }
 
 type plantUMLClient struct {
@@ -78,6 +85,24 @@ func (c *plantUMLClient) Extract(ctx context.Context, in *ExtractRequest, opts .
 	return out, nil
 }
 
+func (c *plantUMLClient) GetInclude(ctx context.Context, in *GetIncludeRequest, opts ...grpc.CallOption) (*GetIncludeResponse, error) {
+	out := new(GetIncludeResponse)
+	err := c.cc.Invoke(ctx, "/pb.PlantUML/GetInclude", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *plantUMLClient) ListIncludes(ctx context.Context, in *ListIncludesRequest, opts ...grpc.CallOption) (*ListIncludesResponse, error) {
+	out := new(ListIncludesResponse)
+	err := c.cc.Invoke(ctx, "/pb.PlantUML/ListIncludes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PlantUMLServer is the server API for PlantUML service.
 // All implementations must embed UnimplementedPlantUMLServer
 // for forward compatibility
@@ -96,6 +121,13 @@ type PlantUMLServer interface {
 	// NOTE: Whitespace isn't guaranteed to be stable so the encoded result
 	// before -> after may differ.
 	Extract(context.Context, *ExtractRequest) (*ExtractResponse, error)
+	// Read shared files that diagrams can !include by name
+	//
+	// Every upload with new content is kept as a new version. Diagrams get
+	// the latest with "!include <name>", or pin one with "!include <name@3>".
+	// Uploads go through the Admin service.
+	GetInclude(context.Context, *GetIncludeRequest) (*GetIncludeResponse, error)
+	ListIncludes(context.Context, *ListIncludesRequest) (*ListIncludesResponse, error)
 	mustEmbedUnimplementedPlantUMLServer()
 }
 
@@ -115,6 +147,12 @@ func (UnimplementedPlantUMLServer) Expand(context.Context, *ExpandRequest) (*Exp
 func (UnimplementedPlantUMLServer) Extract(context.Context, *ExtractRequest) (*ExtractResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Extract not implemented")
 }
+func (UnimplementedPlantUMLServer) GetInclude(context.Context, *GetIncludeRequest) (*GetIncludeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInclude not implemented")
+}
+func (UnimplementedPlantUMLServer) ListIncludes(context.Context, *ListIncludesRequest) (*ListIncludesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListIncludes not implemented")
+}
 func (UnimplementedPlantUMLServer) mustEmbedUnimplementedPlantUMLServer() {}
 
 // UnsafePlantUMLServer may be embedded to opt out of forward compatibility for this service.
@@ -200,6 +238,42 @@ func _PlantUML_Extract_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PlantUML_GetInclude_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetIncludeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlantUMLServer).GetInclude(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.PlantUML/GetInclude",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlantUMLServer).GetInclude(ctx, req.(*GetIncludeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlantUML_ListIncludes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListIncludesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlantUMLServer).ListIncludes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.PlantUML/ListIncludes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlantUMLServer).ListIncludes(ctx, req.(*ListIncludesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // PlantUML_ServiceDesc is the grpc.ServiceDesc for PlantUML service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -223,6 +297,296 @@ var PlantUML_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Extract",
 			Handler:    _PlantUML_Extract_Handler,
 		},
+		{
+			MethodName: "GetInclude",
+			Handler:    _PlantUML_GetInclude_Handler,
+		},
+		{
+			MethodName: "ListIncludes",
+			Handler:    _PlantUML_ListIncludes_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pb/api.proto",
+}
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	// Upload and remove shared files, see PlantUML.GetInclude
+	PutInclude(ctx context.Context, in *PutIncludeRequest, opts ...grpc.CallOption) (*PutIncludeResponse, error)
+	DeleteInclude(ctx context.Context, in *DeleteIncludeRequest, opts ...grpc.CallOption) (*DeleteIncludeResponse, error)
+	// Inspect and clear cached renders
+	//
+	// Purging removes diagrams from every groupcache peer, so stale renders
+	// can be fixed without restarting the fleet.
+	LookupCache(ctx context.Context, in *LookupCacheRequest, opts ...grpc.CallOption) (*LookupCacheResponse, error)
+	PurgeCache(ctx context.Context, in *PurgeCacheRequest, opts ...grpc.CallOption) (*PurgeCacheResponse, error)
+	GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*GetCacheStatsResponse, error)
+	// Render diagrams from the server's prefill directory into the cache
+	//
+	// Runs at background priority, yielding to other renders.
+	Prefill(ctx context.Context, in *PrefillRequest, opts ...grpc.CallOption) (*PrefillResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) PutInclude(ctx context.Context, in *PutIncludeRequest, opts ...grpc.CallOption) (*PutIncludeResponse, error) {
+	out := new(PutIncludeResponse)
+	err := c.cc.Invoke(ctx, "/pb.Admin/PutInclude", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DeleteInclude(ctx context.Context, in *DeleteIncludeRequest, opts ...grpc.CallOption) (*DeleteIncludeResponse, error) {
+	out := new(DeleteIncludeResponse)
+	err := c.cc.Invoke(ctx, "/pb.Admin/DeleteInclude", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) LookupCache(ctx context.Context, in *LookupCacheRequest, opts ...grpc.CallOption) (*LookupCacheResponse, error) {
+	out := new(LookupCacheResponse)
+	err := c.cc.Invoke(ctx, "/pb.Admin/LookupCache", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PurgeCache(ctx context.Context, in *PurgeCacheRequest, opts ...grpc.CallOption) (*PurgeCacheResponse, error) {
+	out := new(PurgeCacheResponse)
+	err := c.cc.Invoke(ctx, "/pb.Admin/PurgeCache", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*GetCacheStatsResponse, error) {
+	out := new(GetCacheStatsResponse)
+	err := c.cc.Invoke(ctx, "/pb.Admin/GetCacheStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Prefill(ctx context.Context, in *PrefillRequest, opts ...grpc.CallOption) (*PrefillResponse, error) {
+	out := new(PrefillResponse)
+	err := c.cc.Invoke(ctx, "/pb.Admin/Prefill", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	// Upload and remove shared files, see PlantUML.GetInclude
+	PutInclude(context.Context, *PutIncludeRequest) (*PutIncludeResponse, error)
+	DeleteInclude(context.Context, *DeleteIncludeRequest) (*DeleteIncludeResponse, error)
+	// Inspect and clear cached renders
+	//
+	// Purging removes diagrams from every groupcache peer, so stale renders
+	// can be fixed without restarting the fleet.
+	LookupCache(context.Context, *LookupCacheRequest) (*LookupCacheResponse, error)
+	PurgeCache(context.Context, *PurgeCacheRequest) (*PurgeCacheResponse, error)
+	GetCacheStats(context.Context, *GetCacheStatsRequest) (*GetCacheStatsResponse, error)
+	// Render diagrams from the server's prefill directory into the cache
+	//
+	// Runs at background priority, yielding to other renders.
+	Prefill(context.Context, *PrefillRequest) (*PrefillResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) PutInclude(context.Context, *PutIncludeRequest) (*PutIncludeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutInclude not implemented")
+}
+func (UnimplementedAdminServer) DeleteInclude(context.Context, *DeleteIncludeRequest) (*DeleteIncludeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteInclude not implemented")
+}
+func (UnimplementedAdminServer) LookupCache(context.Context, *LookupCacheRequest) (*LookupCacheResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LookupCache not implemented")
+}
+func (UnimplementedAdminServer) PurgeCache(context.Context, *PurgeCacheRequest) (*PurgeCacheResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeCache not implemented")
+}
+func (UnimplementedAdminServer) GetCacheStats(context.Context, *GetCacheStatsRequest) (*GetCacheStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCacheStats not implemented")
+}
+func (UnimplementedAdminServer) Prefill(context.Context, *PrefillRequest) (*PrefillResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Prefill not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_PutInclude_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutIncludeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PutInclude(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Admin/PutInclude",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PutInclude(ctx, req.(*PutIncludeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DeleteInclude_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteIncludeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeleteInclude(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Admin/DeleteInclude",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeleteInclude(ctx, req.(*DeleteIncludeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_LookupCache_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupCacheRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).LookupCache(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Admin/LookupCache",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).LookupCache(ctx, req.(*LookupCacheRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_PurgeCache_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeCacheRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PurgeCache(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Admin/PurgeCache",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PurgeCache(ctx, req.(*PurgeCacheRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetCacheStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCacheStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetCacheStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Admin/GetCacheStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetCacheStats(ctx, req.(*GetCacheStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Prefill_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PrefillRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Prefill(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Admin/Prefill",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Prefill(ctx, req.(*PrefillRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PutInclude",
+			Handler:    _Admin_PutInclude_Handler,
+		},
+		{
+			MethodName: "DeleteInclude",
+			Handler:    _Admin_DeleteInclude_Handler,
+		},
+		{
+			MethodName: "LookupCache",
+			Handler:    _Admin_LookupCache_Handler,
+		},
+		{
+			MethodName: "PurgeCache",
+			Handler:    _Admin_PurgeCache_Handler,
+		},
+		{
+			MethodName: "GetCacheStats",
+			Handler:    _Admin_GetCacheStats_Handler,
+		},
+		{
+			MethodName: "Prefill",
+			Handler:    _Admin_Prefill_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "pb/api.proto",
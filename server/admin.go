@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Status is what a Handler reports on the admin status page
+type Status struct {
+	Ready bool
+
+	// Worker pools, one per PlantUML version. Empty with a custom Renderer.
+	Pools []PoolStatus
+
+	// The RenderCache in use: group, lru, none, or custom. Empty without one.
+	Cache      string
+	CacheStats []*pb.CacheStats
+}
+
+// PoolStatus is a snapshot of a WorkerPool
+type PoolStatus struct {
+	// PlantUML version name, empty when there's only one pool
+	Version      string
+	PlantUMLPath string
+
+	MinWorkers, MaxWorkers int
+
+	// Running includes workers still warming up
+	Running, Warm, Busy int64
+
+	// Requests waiting for a worker
+	Queued int64
+
+	Graphviz bool
+
+	// Last start failure, while the breaker is tripped
+	BreakerErr error
+}
+
+// Status returns a snapshot of wp's workers
+func (wp *WorkerPool) Status() PoolStatus {
+	minWorkers, maxWorkers := wp.workerBounds()
+	return PoolStatus{
+		PlantUMLPath: wp.PlantUMLPath,
+		MinWorkers:   minWorkers,
+		MaxWorkers:   maxWorkers,
+		Running:      atomic.LoadInt64(&wp.running),
+		Warm:         atomic.LoadInt64(&wp.warmWorkers),
+		Busy:         atomic.LoadInt64(&wp.busyWorkers),
+		Queued:       atomic.LoadInt64(&wp.queued),
+		Graphviz:     wp.Graphviz(),
+		BreakerErr:   wp.breaker.Err(),
+	}
+}
+
+// Status is shown on the admin status page
+func (h *handler) Status() *Status {
+	s := &Status{Ready: h.Ready()}
+	for _, wp := range h.pools() {
+		s.Pools = append(s.Pools, wp.Status())
+	}
+	for i, name := range sortedVersions(h.Versions) {
+		s.Pools[i].Version = name
+	}
+	if h.Cache != nil {
+		s.Cache = cacheTier(h.Cache)
+	}
+	if stats, err := h.GetCacheStats(context.Background(), &pb.GetCacheStatsRequest{}); err == nil {
+		s.CacheStats = stats.Caches
+	}
+	return s
+}
+
+// AdminHandler serves operational endpoints for h, separate from renders
+//
+//	GET /metrics       Prometheus metrics
+//	GET /healthz       200 while the process is up
+//	GET /readyz        200 once h is ready, otherwise 503
+//	GET /debug/pprof/  Go profiling
+//	GET /              status page: workers, queues, cache peers, and config
+//
+// When h implements pb.AdminServer, the Admin gRPC service is served too,
+// over HTTP/2 without TLS. It's made with MakeGRPC, like the main server.
+//
+// peers and config are only listed on the status page, and may be nil. Keep
+// it off networks that clients can reach, since pprof and the status page
+// show internals, and the Admin service changes what every client sees.
+func AdminHandler(h Handler, peers *PeerWatcher, config map[string]string) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !handlerReady(h) {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		statusPage(w, h, peers, config)
+	})
+
+	admin, ok := h.(pb.AdminServer)
+	if !ok {
+		return mux
+	}
+	grpcSrv := MakeGRPC()
+	pb.RegisterAdminServer(grpcSrv, admin)
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcSrv.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
+
+type statusPageData struct {
+	*Status
+	Now    time.Time
+	Peers  []string
+	Config [][2]string
+}
+
+func statusPage(w http.ResponseWriter, h Handler, peers *PeerWatcher, config map[string]string) {
+	data := statusPageData{Status: &Status{Ready: handlerReady(h)}, Now: time.Now()}
+	if s, ok := h.(interface{ Status() *Status }); ok {
+		data.Status = s.Status()
+	}
+	if peers != nil {
+		data.Peers = peers.Peers()
+	}
+	for k, v := range config {
+		data.Config = append(data.Config, [2]string{k, v})
+	}
+	sort.Slice(data.Config, func(i, j int) bool { return data.Config[i][0] < data.Config[j][0] })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, data); err != nil {
+		glog.Errorf("unable to render admin status page: %v", err)
+	}
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>pmlproxy</title></head>
+<body>
+<h1>pmlproxy</h1>
+<p>Ready: <b>{{.Ready}}</b> as of {{.Now.Format "2006-01-02 15:04:05 MST"}}</p>
+<p><a href="/metrics">metrics</a> · <a href="/debug/pprof/">pprof</a></p>
+
+<h2>Workers</h2>
+{{if .Pools}}
+<table border="1" cellpadding="4">
+<tr><th>version</th><th>jar</th><th>running</th><th>warm</th><th>busy</th><th>queued</th><th>min</th><th>max</th><th>graphviz</th><th>breaker</th></tr>
+{{range .Pools}}
+<tr><td>{{or .Version "default"}}</td><td>{{.PlantUMLPath}}</td><td>{{.Running}}</td><td>{{.Warm}}</td><td>{{.Busy}}</td><td>{{.Queued}}</td><td>{{.MinWorkers}}</td><td>{{.MaxWorkers}}</td><td>{{.Graphviz}}</td><td>{{if .BreakerErr}}tripped: {{.BreakerErr}}{{else}}ok{{end}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>Rendering with a custom renderer.</p>
+{{end}}
+
+<h2>Cache</h2>
+<p>In memory: {{or .Cache "disabled"}}</p>
+{{if .CacheStats}}
+<table border="1" cellpadding="4">
+<tr><th>cache</th><th>items</th><th>bytes</th><th>gets</th><th>hits</th><th>evictions</th></tr>
+{{range .CacheStats}}
+<tr><td>{{.Name}}</td><td>{{.Items}}</td><td>{{.Bytes}}</td><td>{{.Gets}}</td><td>{{.Hits}}</td><td>{{.Evictions}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{if .Peers}}
+<h3>Peers</h3>
+<ul>{{range .Peers}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+
+{{if .Config}}
+<h2>Config</h2>
+<table border="1" cellpadding="4">
+{{range .Config}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
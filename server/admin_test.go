@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc"
+)
+
+func adminGet(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestAdminHandler(t *testing.T) {
+	h := fakeHandler(t)
+	h.Cache = NewLRUCache(1<<20, 0)
+	peers := &PeerWatcher{Self: "http://10.0.0.1:9001"}
+	peers.Refresh(context.Background())
+	admin := AdminHandler(h, peers, map[string]string{"workers": "1"})
+
+	for path, want := range map[string]string{
+		"/healthz":      "ok",
+		"/readyz":       "ok",
+		"/metrics":      "PlantUML_worker_starts_total",
+		"/debug/pprof/": "goroutine",
+	} {
+		code, body := adminGet(t, admin, path)
+		if code != http.StatusOK || !strings.Contains(body, want) {
+			t.Errorf("expected %s to be OK with %q, got %d: %.200s", path, want, code, body)
+		}
+	}
+
+	code, body := adminGet(t, admin, "/")
+	if code != http.StatusOK {
+		t.Fatalf("expected status page, got %d", code)
+	}
+	for _, want := range []string{"Ready: <b>true</b>", "<td>default</td>", "<td>lru</td>", "http://10.0.0.1:9001", "<td>workers</td><td>1</td>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected status page to contain %q:\n%s", want, body)
+		}
+	}
+
+	if code, _ := adminGet(t, admin, "/nope"); code != http.StatusNotFound {
+		t.Errorf("expected unknown paths to 404, got %d", code)
+	}
+}
+
+func TestAdminNotReady(t *testing.T) {
+	// Workers are never started
+	h := &handler{WorkerPool: *fakePool(t)}
+	admin := AdminHandler(h, nil, nil)
+	if code, _ := adminGet(t, admin, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 before workers are warm, got %d", code)
+	}
+	if code, _ := adminGet(t, admin, "/healthz"); code != http.StatusOK {
+		t.Errorf("expected healthz to be OK while alive, got %d", code)
+	}
+}
+
+// customHandler is a Handler from outside the package, without Ready()
+type customHandler struct {
+	pb.UnimplementedPlantUMLServer
+}
+
+func (customHandler) ManageWorkers(ctx context.Context) {}
+
+func TestAdminReadyWithoutReadiness(t *testing.T) {
+	admin := AdminHandler(customHandler{}, nil, nil)
+	if code, _ := adminGet(t, admin, "/readyz"); code != http.StatusOK {
+		t.Errorf("expected handlers without Ready() to be ready, got %d", code)
+	}
+}
+
+func TestAdminService(t *testing.T) {
+	lib, err := NewIncludeLibrary(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := &handler{Renderer: echoRenderer, Library: lib}
+	srv := httptest.NewServer(AdminHandler(h, nil, nil))
+	defer srv.Close()
+
+	conn, err := grpc.Dial(strings.TrimPrefix(srv.URL, "http://"), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+	resp, err := pb.NewAdminClient(conn).PutInclude(ctx, &pb.PutIncludeRequest{Name: "ourcorp/style", Content: []byte("v1")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.File.Version != 1 {
+		t.Errorf("expected version 1, got %d", resp.File.Version)
+	}
+
+	// The rest of the admin endpoints are unaffected
+	httpResp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		t.Errorf("expected healthz to be OK, got %d", httpResp.StatusCode)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker stops us from endlessly respawning workers that can't start
+//
+// After threshold consecutive start failures it trips, and stays tripped until
+// a worker successfully warms up. Respawning is paused for cooldown after every
+// failure while tripped, so a broken install doesn't spin the CPU.
+//
+// Methods are safe to call on a nil breaker, which never trips.
+type breaker struct {
+	mu       sync.Mutex
+	failures int
+	lastErr  error
+	retryAt  time.Time
+	tripped  chan struct{} // closed while tripped
+}
+
+func newBreaker() *breaker {
+	return &breaker{tripped: make(chan struct{})}
+}
+
+// failure records a worker that couldn't start, returning true if tripped
+func (b *breaker) failure(err error, threshold int, cooldown time.Duration) bool {
+	if b == nil || threshold <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastErr = err
+	if b.failures < threshold {
+		return false
+	}
+	if b.failures == threshold {
+		close(b.tripped)
+	}
+	b.retryAt = time.Now().Add(cooldown)
+	return true
+}
+
+// success resets the breaker once a worker is up
+func (b *breaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err() != nil {
+		b.tripped = make(chan struct{})
+	}
+	b.failures = 0
+	b.lastErr = nil
+	b.retryAt = time.Time{}
+}
+
+// Err returns the last start failure if tripped, otherwise nil
+func (b *breaker) Err() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err()
+}
+
+func (b *breaker) err() error {
+	select {
+	case <-b.tripped:
+		return b.lastErr
+	default:
+		return nil
+	}
+}
+
+// RetryAt is when workers may be spawned again, zero if not paused
+func (b *breaker) RetryAt() time.Time {
+	if b == nil {
+		return time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retryAt
+}
+
+// Tripped returns a channel that's closed while the breaker is tripped
+func (b *breaker) Tripped() <-chan struct{} {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tripped
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker()
+	failErr := errors.New("no java")
+
+	if b.failure(failErr, 3, time.Minute) || b.failure(failErr, 3, time.Minute) {
+		t.Fatalf("tripped before reaching threshold")
+	}
+	if b.Err() != nil {
+		t.Errorf("expected no error before tripping, got: %v", b.Err())
+	}
+
+	if !b.failure(failErr, 3, time.Minute) {
+		t.Fatalf("expected to trip at threshold")
+	}
+	if b.Err() != failErr {
+		t.Errorf("expected last failure, got: %v", b.Err())
+	}
+	if !b.RetryAt().After(time.Now()) {
+		t.Errorf("expected retry in the future, got: %v", b.RetryAt())
+	}
+	select {
+	case <-b.Tripped():
+	default:
+		t.Errorf("expected tripped channel to be closed")
+	}
+
+	b.success()
+	if b.Err() != nil || !b.RetryAt().IsZero() {
+		t.Errorf("expected reset after success, got: %v, %v", b.Err(), b.RetryAt())
+	}
+	select {
+	case <-b.Tripped():
+		t.Errorf("expected a fresh tripped channel after success")
+	default:
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *breaker
+	if b.failure(errors.New("boom"), 1, time.Minute) {
+		t.Errorf("nil breaker should never trip")
+	}
+	b.success()
+	if b.Err() != nil || b.Tripped() != nil || !b.RetryAt().IsZero() {
+		t.Errorf("nil breaker should be closed")
+	}
+}
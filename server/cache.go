@@ -0,0 +1,387 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/mailgun/groupcache/v2"
+	"github.com/mailgun/groupcache/v2/singleflight"
+	"google.golang.org/protobuf/proto"
+)
+
+// RenderCache stores render results by cache key, see handler.cacheKey
+//
+// Caches may also implement these, for the cache admin RPCs:
+//
+//	Contains(ctx context.Context, key string) (bool, error)
+//	Remove(ctx context.Context, key string) error
+//	Owner(key string) string
+//	Stats() (*pb.GroupCacheStats, []*pb.CacheStats)
+type RenderCache interface {
+	// Get returns the result for key, calling fill to render it on a miss
+	//
+	// The request being rendered is in ctx. Implementations may call fill
+	// for keys from elsewhere, like groupcache peers.
+	Get(ctx context.Context, key string, fill FillFunc) (*pb.RenderResponse, error)
+}
+
+// FillFunc renders the request in ctx, whose cache key is key
+type FillFunc func(ctx context.Context, key string) (*pb.RenderResponse, error)
+
+// NoCache renders every request
+type NoCache struct{}
+
+func (NoCache) Get(ctx context.Context, key string, fill FillFunc) (*pb.RenderResponse, error) {
+	return fill(ctx, key)
+}
+
+// errNotCached is returned by fills during lookups, instead of rendering
+var errNotCached = errors.New("not cached")
+
+// GroupCache shares renders between servers with groupcache
+//
+// Groups are global to the process and registered by name, so each GroupCache
+// needs its own. You MUST take care of managing the groupcache pool yourself,
+// see CachePoolOptions. Without one, it only caches on the local instance.
+type GroupCache struct {
+	Name  string
+	Bytes int64
+
+	// Pool the group's peers are in, to report which owns a key (optional)
+	Pool *groupcache.HTTPPool
+
+	mu    sync.Mutex
+	group *groupcache.Group
+}
+
+// NewGroupCache returns a GroupCache for a group that isn't registered yet
+func NewGroupCache(name string, bytes int64) *GroupCache {
+	return &GroupCache{Name: name, Bytes: bytes}
+}
+
+// Get registers the group on first use, if ManageWorkers hasn't already
+func (c *GroupCache) Get(ctx context.Context, key string, fill FillFunc) (*pb.RenderResponse, error) {
+	group, err := c.register(fill)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp pb.RenderResponse
+	err = group.Get(ctx, key, groupcache.ProtoSink(&resp))
+	if errors.Is(err, errNotCached) {
+		// Shared a load with a concurrent Contains
+		err = group.Get(ctx, key, groupcache.ProtoSink(&resp))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// register creates the group, with fill for this server's and peers' misses
+//
+// Until it's registered, peers asking this server for a key render it
+// themselves.
+func (c *GroupCache) register(fill FillFunc) (*groupcache.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.group != nil {
+		return c.group, nil
+	}
+	// groupcache panics on duplicates
+	if groupcache.GetGroup(c.Name) != nil {
+		return nil, fmt.Errorf("groupcache group %q is already registered", c.Name)
+	}
+	c.group = groupcache.NewGroup(c.Name, c.Bytes, groupcache.GetterFunc(
+		func(ctx context.Context, key string, dest groupcache.Sink) error {
+			if lookupOnly(ctx) {
+				return errNotCached
+			}
+			resp, err := fill(ctx, key)
+			if err != nil {
+				return err
+			}
+			return dest.SetProto(resp, time.Time{})
+		},
+	))
+	return c.group, nil
+}
+
+func (c *GroupCache) registered() *groupcache.Group {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.group
+}
+
+// Contains asks the key's owner whether it's cached, without rendering it
+func (c *GroupCache) Contains(ctx context.Context, key string) (bool, error) {
+	group := c.registered()
+	if group == nil {
+		return false, nil
+	}
+	var resp pb.RenderResponse
+	err := group.Get(withLookupOnly(ctx), key, groupcache.ProtoSink(&resp))
+	if errors.Is(err, errNotCached) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Remove purges key from this server and every peer
+func (c *GroupCache) Remove(ctx context.Context, key string) error {
+	group := c.registered()
+	if group == nil {
+		return nil
+	}
+	return group.Remove(ctx, key)
+}
+
+// Owner returns the peer responsible for key, "" if it's this server
+func (c *GroupCache) Owner(key string) string {
+	if c.Pool == nil {
+		return ""
+	}
+	peer, ok := c.Pool.PickPeer(key)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(peer.GetURL(), "/"), "/_groupcache")
+}
+
+func (c *GroupCache) Stats() (*pb.GroupCacheStats, []*pb.CacheStats) {
+	group := c.registered()
+	if group == nil {
+		return nil, nil
+	}
+	s := &group.Stats
+	stats := &pb.GroupCacheStats{
+		Gets:            s.Gets.Get(),
+		CacheHits:       s.CacheHits.Get(),
+		Loads:           s.Loads.Get(),
+		LoadsDeduped:    s.LoadsDeduped.Get(),
+		LocalLoads:      s.LocalLoads.Get(),
+		LocalLoadErrors: s.LocalLoadErrs.Get(),
+		PeerLoads:       s.PeerLoads.Get(),
+		PeerErrors:      s.PeerErrors.Get(),
+		ServerRequests:  s.ServerRequests.Get(),
+	}
+	var caches []*pb.CacheStats
+	for _, which := range []groupcache.CacheType{groupcache.MainCache, groupcache.HotCache} {
+		cs := group.CacheStats(which)
+		name := "main"
+		if which == groupcache.HotCache {
+			name = "hot"
+		}
+		caches = append(caches, &pb.CacheStats{
+			Name:      name,
+			Bytes:     cs.Bytes,
+			Items:     cs.Items,
+			Gets:      cs.Gets,
+			Hits:      cs.Hits,
+			Evictions: cs.Evictions,
+		})
+	}
+	return stats, caches
+}
+
+// CachePeerHandler serves groupcache peers, also purging disk from them
+//
+// Groupcache only purges memory when peers broadcast a Remove. disk may be nil.
+func CachePeerHandler(pool *groupcache.HTTPPool, disk *DiskCache) http.Handler {
+	return cachePeerHandler(pool, disk)
+}
+
+func cachePeerHandler(pool http.Handler, disk *DiskCache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete && disk != nil {
+			if i := strings.LastIndex(r.URL.Path, "/"); i >= 0 {
+				disk.Remove(r.URL.Path[i+1:])
+			}
+		}
+		if r.Method != http.MethodGet || r.Header.Get(PeerLookupHeader) != "" {
+			pool.ServeHTTP(w, r)
+			return
+		}
+
+		// Peers count what they fetched from us as a peer result, and we
+		// count whether we had it
+		ctx, lookup := withCacheResult(r.Context())
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		pool.ServeHTTP(sw, r.WithContext(ctx))
+		var err error
+		if sw.code != http.StatusOK {
+			err = fmt.Errorf("peer request failed with %d", sw.code)
+		}
+		observeCache("group", lookup.get(err))
+	})
+}
+
+// statusWriter remembers the status code a handler sent
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// LRUCache keeps renders in memory, evicting the least recently used
+//
+// Entries also expire after TTL, if it's set. Concurrent misses for the same
+// key share one render.
+type LRUCache struct {
+	MaxBytes int64
+	TTL      time.Duration
+
+	mu        sync.Mutex
+	size      int64
+	order     *list.List // of *lruEntry, most recent first
+	entries   map[string]*list.Element
+	flight    singleflight.Group
+	gets      int64
+	hits      int64
+	evictions int64
+}
+
+type lruEntry struct {
+	key     string
+	resp    *pb.RenderResponse
+	size    int64
+	expires time.Time
+}
+
+// NewLRUCache holds up to maxBytes of renders, each for up to ttl (0 for no expiry)
+func NewLRUCache(maxBytes int64, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		MaxBytes: maxBytes,
+		TTL:      ttl,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string, fill FillFunc) (*pb.RenderResponse, error) {
+	if resp, ok := c.lookup(key, true); ok {
+		return resp, nil
+	}
+	v, err := c.flight.Do(key, func() (interface{}, error) {
+		if resp, ok := c.lookup(key, false); ok {
+			return resp, nil
+		}
+		resp, err := fill(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		c.add(key, resp)
+		return resp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Callers own what they get back
+	return proto.Clone(v.(*pb.RenderResponse)).(*pb.RenderResponse), nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRUCache) Contains(ctx context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	return ok && !c.expired(el), nil
+}
+
+func (c *LRUCache) Remove(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+func (c *LRUCache) Stats() (*pb.GroupCacheStats, []*pb.CacheStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return nil, []*pb.CacheStats{{
+		Name:      "lru",
+		Bytes:     c.size,
+		Items:     int64(c.order.Len()),
+		Gets:      c.gets,
+		Hits:      c.hits,
+		Evictions: c.evictions,
+	}}
+}
+
+// lookup returns a copy of key's entry, counting it in stats if count is set
+func (c *LRUCache) lookup(key string, count bool) (*pb.RenderResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if count {
+		c.gets++
+	}
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.expired(el) {
+		c.remove(el)
+		return nil, false
+	}
+	if count {
+		c.hits++
+	}
+	c.order.MoveToFront(el)
+	return proto.Clone(el.Value.(*lruEntry).resp).(*pb.RenderResponse), true
+}
+
+func (c *LRUCache) add(key string, resp *pb.RenderResponse) {
+	size := int64(len(key) + proto.Size(resp))
+	if size > c.MaxBytes {
+		return
+	}
+	e := &lruEntry{key: key, resp: proto.Clone(resp).(*pb.RenderResponse), size: size}
+	if c.TTL > 0 {
+		e.expires = time.Now().Add(c.TTL)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(e)
+	c.size += size
+	for c.size > c.MaxBytes {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// expired needs c.mu
+func (c *LRUCache) expired(el *list.Element) bool {
+	e := el.Value.(*lruEntry)
+	return !e.expires.IsZero() && time.Now().After(e.expires)
+}
+
+// remove needs c.mu
+func (c *LRUCache) remove(el *list.Element) {
+	e := el.Value.(*lruEntry)
+	c.order.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var testGroups int32
+
+// testGroupName is unique to each run of a test, since groupcache's groups
+// are global and can't be removed
+func testGroupName(t *testing.T) string {
+	return fmt.Sprintf("%s-%d", t.Name(), atomic.AddInt32(&testGroups, 1))
+}
+
+// countingFill renders key as the only page, counting calls
+func countingFill(calls *int32) FillFunc {
+	return func(ctx context.Context, key string) (*pb.RenderResponse, error) {
+		atomic.AddInt32(calls, 1)
+		return &pb.RenderResponse{Data: [][]byte{[]byte(key)}}, nil
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	var calls int32
+	fill := countingFill(&calls)
+
+	c := NewLRUCache(1<<20, 0)
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(ctx, "a", fill)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(resp.Data[0]) != "a" {
+			t.Errorf("expected %q, got %q", "a", resp.Data[0])
+		}
+		// Callers can't change what's cached
+		resp.Data[0] = []byte("changed")
+	}
+	if calls != 1 {
+		t.Errorf("expected a cache hit, got %d renders", calls)
+	}
+
+	// Errors aren't cached
+	fail := func(ctx context.Context, key string) (*pb.RenderResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, fmt.Errorf("syntax error")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, "b", fail); err == nil {
+			t.Errorf("expected an error")
+		}
+	}
+	if calls != 3 {
+		t.Errorf("expected failed renders to be retried, got %d renders", calls)
+	}
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	var calls int32
+	fill := countingFill(&calls)
+
+	// Room for three entries: a one-byte key, and a one-byte page in 3 bytes
+	c := NewLRUCache(15, 0)
+	for _, key := range []string{"a", "b", "c"} {
+		c.Get(ctx, key, fill)
+	}
+	c.Get(ctx, "a", fill)
+	c.Get(ctx, "d", fill)
+	if c.Len() != 3 {
+		t.Errorf("expected 3 entries, got %d", c.Len())
+	}
+
+	calls = 0
+	c.Get(ctx, "a", fill)
+	if calls != 0 {
+		t.Errorf("expected recently used entry to be kept")
+	}
+	c.Get(ctx, "b", fill)
+	if calls != 1 {
+		t.Errorf("expected least recently used entry to be evicted")
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	var calls int32
+	c := NewLRUCache(1<<20, time.Millisecond*50)
+	c.Get(ctx, "a", countingFill(&calls))
+	c.Get(ctx, "a", countingFill(&calls))
+	time.Sleep(time.Millisecond * 100)
+	c.Get(ctx, "a", countingFill(&calls))
+	if calls != 2 {
+		t.Errorf("expected expired entry to be rendered again, got %d renders", calls)
+	}
+}
+
+func TestLRUCacheConcurrentMisses(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	fill := func(ctx context.Context, key string) (*pb.RenderResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &pb.RenderResponse{}, nil
+	}
+
+	c := NewLRUCache(1<<20, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Get(context.Background(), "a", fill)
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("expected concurrent misses to share a render, got %d", calls)
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	var calls int32
+	for i := 0; i < 2; i++ {
+		NoCache{}.Get(context.Background(), "a", countingFill(&calls))
+	}
+	if calls != 2 {
+		t.Errorf("expected every request to render, got %d renders", calls)
+	}
+}
+
+func TestGroupCacheDuplicate(t *testing.T) {
+	var calls int32
+	name := testGroupName(t)
+	first := NewGroupCache(name, 1<<20)
+	if _, err := first.Get(context.Background(), "a", countingFill(&calls)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second := NewGroupCache(name, 1<<20)
+	if _, err := second.Get(context.Background(), "a", countingFill(&calls)); err == nil {
+		t.Errorf("expected an error for a group that's already registered")
+	}
+}
+
+func TestBypassCache(t *testing.T) {
+	var renders int32
+	h := &handler{
+		Cache: NewLRUCache(1<<20, 0),
+		Renderer: RendererFunc(func(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+			atomic.AddInt32(&renders, 1)
+			return [][]byte{[]byte(text)}, nil
+		}),
+	}
+	req := &pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml\nrectangle Foo\n@enduml"}, Format: pb.Format_SVG}
+	h.Render(context.Background(), req)
+	h.Render(context.Background(), req)
+	if renders != 1 {
+		t.Fatalf("expected a cache hit, got %d renders", renders)
+	}
+
+	// Only trusted callers can skip the cache
+	req.BypassCache = true
+	if _, err := h.Render(context.Background(), req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied without AllowBypassCache, got: %v", err)
+	}
+	short, _ := ToShort(req.Diagram.Full)
+	rec := httptest.NewRecorder()
+	HTTPHandler(h).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/svg/"+short+"?bypass_cache=true", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected http bypass to be forbidden, got %d", rec.Code)
+	}
+	h.AllowBypassCache = true
+	h.Render(context.Background(), req)
+	if renders != 2 {
+		t.Errorf("expected bypass to render, got %d renders", renders)
+	}
+}
+
+func TestCacheAdmin(t *testing.T) {
+	ctx := context.Background()
+	disk, err := NewDiskCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := &handler{Cache: NewLRUCache(1<<20, 0), DiskCache: disk, Renderer: echoRenderer}
+	req := &pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml\nrectangle Foo\n@enduml"}, Format: pb.Format_SVG}
+
+	lookup, err := h.LookupCache(ctx, &pb.LookupCacheRequest{Request: req})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lookup.Cached || lookup.OnDisk {
+		t.Errorf("expected a miss before rendering: %v", lookup)
+	}
+
+	h.Render(ctx, req)
+	lookup, _ = h.LookupCache(ctx, &pb.LookupCacheRequest{Request: req})
+	if !lookup.Cached || !lookup.OnDisk || lookup.Owner != "" {
+		t.Errorf("expected a local hit after rendering: %v", lookup)
+	}
+
+	purged, err := h.PurgeCache(ctx, &pb.PurgeCacheRequest{Requests: []*pb.RenderRequest{req}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(purged.Keys) != 1 || purged.Keys[0] != lookup.Key {
+		t.Errorf("expected %s to be purged, got %v", lookup.Key, purged.Keys)
+	}
+	lookup, _ = h.LookupCache(ctx, &pb.LookupCacheRequest{Request: req})
+	if lookup.Cached || lookup.OnDisk {
+		t.Errorf("expected a miss after purging: %v", lookup)
+	}
+
+	if _, err := h.PurgeCache(ctx, &pb.PurgeCacheRequest{Keys: []string{"../../etc"}}); err == nil {
+		t.Errorf("expected an invalid key to be rejected")
+	}
+
+	stats, err := h.GetCacheStats(ctx, &pb.GetCacheStatsRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Group != nil || len(stats.Caches) != 2 || stats.Caches[0].Name != "lru" || stats.Caches[1].Name != "disk" {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+}
+
+func TestCachePeerHandler(t *testing.T) {
+	disk, err := NewDiskCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	disk.Put(diskKey(1), []byte("stale"))
+
+	var served bool
+	pool := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served = true })
+	h := cachePeerHandler(pool, disk)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/_groupcache/render/"+diskKey(1), nil))
+	if disk.Contains(diskKey(1)) {
+		t.Errorf("expected peer purge to remove disk entry")
+	}
+	if !served {
+		t.Errorf("expected request to reach groupcache")
+	}
+}
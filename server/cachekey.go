@@ -0,0 +1,337 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/golang/glog"
+	"github.com/mailgun/groupcache/v2"
+	"github.com/mailgun/groupcache/v2/singleflight"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+// Bump when renders for the same inputs change, eg. a new pipe protocol
+const cacheKeySchema = "pmlproxy-render-v1"
+
+// cacheKey is a digest of everything that affects a render
+//
+// Covers the format, layout, normalized text, request files, and the
+// fingerprint of the backend that will render it — for PlantUML, the jar's
+// content, worker args, and include directory — along with the include
+// library's files. Keys stay small no matter the diagram, and change when any
+// of those do.
+func (h *handler) cacheKey(req *pb.RenderRequest) (string, error) {
+	text, err := diagramText(req.Diagram)
+	if err != nil {
+		return "", err
+	}
+
+	d := keyDigest{sha256.New()}
+	d.add(cacheKeySchema)
+	d.add(req.Format.String())
+	d.add(req.Layout.String())
+	d.add(normalizeText(text))
+	d.add(filesDigest(req.Files))
+	d.add(req.Version)
+	if f, ok := h.backend(req.Version).(interface{ CacheFingerprint() string }); ok {
+		d.add(f.CacheFingerprint())
+	}
+	if h.Library != nil {
+		d.add(h.Library.CacheFingerprint())
+	}
+	return hex.EncodeToString(d.Sum(nil)), nil
+}
+
+// cacheKeyFormat matches keys from cacheKey, and is loose enough for tests.
+// Disk cache entries are named after keys, so nothing else is accepted.
+var cacheKeyFormat = regexp.MustCompile(`^[0-9a-f]{8,128}$`)
+
+// keyDigest hashes length-prefixed parts, so boundaries can't shift
+type keyDigest struct {
+	hash.Hash
+}
+
+func (d keyDigest) add(s string) {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(s)))
+	d.Write(size[:])
+	io.WriteString(d, s)
+}
+
+// CacheFingerprint identifies what the pool renders with, for cache keys
+//
+// Content-based rather than timestamps, so peers with the same install agree.
+// Refreshed in the background every fingerprintTTL.
+func (wp *WorkerPool) CacheFingerprint() string {
+	d := keyDigest{sha256.New()}
+	d.add(cachedDigest("jar:"+wp.PlantUMLPath, func() string { return fileDigest(wp.PlantUMLPath) }))
+	d.add(cachedDigest("dir:"+wp.SearchPath, func() string { return dirDigest(wp.SearchPath) }))
+	if wp.Dir != "" && wp.Dir != wp.SearchPath {
+		d.add(cachedDigest("dir:"+wp.Dir, func() string { return dirDigest(wp.Dir) }))
+	}
+	d.add(strings.Join(wp.GetWorkerArgs(), "\x00"))
+	if wp.Graphviz() {
+		d.add("graphviz")
+	}
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+// CacheFingerprint identifies the upstreams, for cache keys
+func (r *RemoteRenderer) CacheFingerprint() string {
+	return strings.Join(r.Upstreams, "\x00")
+}
+
+// CacheFingerprint identifies the latest version of every file, for cache keys
+//
+// Diagrams can include the latest by path, which Pin doesn't cover. Only the
+// files the library manages are hashed, not the rest of Dir. Refreshed in the
+// background every fingerprintTTL.
+func (l *IncludeLibrary) CacheFingerprint() string {
+	return cachedDigest("library:"+l.Dir, func() string {
+		files, err := l.List("", false)
+		if err != nil {
+			glog.Warningf("unable to fingerprint include library: %v", err)
+			return ""
+		}
+		d := keyDigest{sha256.New()}
+		for _, f := range files {
+			d.add(f.Name)
+			d.add(f.Sha256)
+		}
+		return hex.EncodeToString(d.Sum(nil))
+	})
+}
+
+const fingerprintTTL = time.Second * 10
+
+var digests = struct {
+	sync.Mutex
+	m     map[string]cachedValue
+	first singleflight.Group
+}{m: map[string]cachedValue{}}
+
+type cachedValue struct {
+	value      string
+	at         time.Time
+	refreshing bool
+}
+
+// cachedDigest returns compute's last result for key
+//
+// Only the first call for a key waits on compute, sharing the result with
+// concurrent callers. After that, stale values are returned while a single
+// background refresh runs, so requests never wait on hashing.
+func cachedDigest(key string, compute func() string) string {
+	digests.Lock()
+	v, ok := digests.m[key]
+	refresh := ok && !v.refreshing && time.Since(v.at) >= fingerprintTTL
+	if refresh {
+		v.refreshing = true
+		digests.m[key] = v
+	}
+	digests.Unlock()
+
+	store := func() string {
+		value := compute()
+		digests.Lock()
+		digests.m[key] = cachedValue{value: value, at: time.Now()}
+		digests.Unlock()
+		return value
+	}
+	if !ok {
+		value, _ := digests.first.Do(key, func() (interface{}, error) {
+			return store(), nil
+		})
+		return value.(string)
+	}
+	if refresh {
+		go store()
+	}
+	return v.value
+}
+
+// fileDigest hashes a file's content, "" if it can't be read
+func fileDigest(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Bounds on hashing an include directory, which may be somewhere large like
+// the working directory.
+const (
+	maxDirDigestFiles     = 10000
+	maxDirDigestFileBytes = 1024 * 1024
+)
+
+var errStopWalk = errors.New("stop walking")
+
+// dirDigest hashes the names and contents of files under dir
+//
+// Hidden files and directories, like the include library's history, are
+// skipped, and so are the contents of big files, which are identified by
+// size instead.
+func dirDigest(dir string) string {
+	d := keyDigest{sha256.New()}
+	var files int
+	filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(e.Name(), ".") {
+			if e.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if e.IsDir() {
+			return nil
+		}
+		if files++; files > maxDirDigestFiles {
+			glog.Warningf("only hashed the first %d files in include path %s", maxDirDigestFiles, dir)
+			return errStopWalk
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		d.add(filepath.ToSlash(rel))
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		if info.Size() > maxDirDigestFileBytes {
+			d.add(strconv.FormatInt(info.Size(), 10))
+			return nil
+		}
+		d.add(fileDigest(path))
+		return nil
+	})
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+// PeerRequestHeader carries the render request between groupcache peers,
+// since keys are only a digest of it.
+const PeerRequestHeader = "X-Pmlproxy-Render-Request"
+
+// PeerLookupHeader asks a peer not to render on a miss, see GroupCache.Contains
+const PeerLookupHeader = "X-Pmlproxy-Lookup-Only"
+
+// Requests bigger than this aren't sent to peers, and get rendered locally
+// instead. Go servers reject headers over 1MB by default.
+const maxPeerHeaderBytes = 512 * 1024
+
+// CachePoolOptions let peers recover render requests from keys
+//
+// Pass them to groupcache.NewHTTPPoolOpts, from github.com/mailgun/groupcache/v2.
+// Replaces ConfigureCachePool, which changed a github.com/golang/groupcache
+// pool after it was made. Mailgun's pools can't be changed once made, but
+// they're needed to remove keys from every peer.
+func CachePoolOptions() *groupcache.HTTPPoolOptions {
+	return &groupcache.HTTPPoolOptions{
+		Transport: func(ctx context.Context) http.RoundTripper {
+			return peerTransport{http.DefaultTransport}
+		},
+		Context: peerContext,
+	}
+}
+
+// peerContext decodes what peerTransport sent
+func peerContext(r *http.Request) context.Context {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	if r.Header.Get(PeerLookupHeader) != "" {
+		ctx = withLookupOnly(ctx)
+	}
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		ctx = WithRequestID(ctx, requestIDOrNew(id))
+	}
+	v := r.Header.Get(PeerRequestHeader)
+	if v == "" {
+		return ctx
+	}
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		glog.Warningf("invalid render request from peer: %v", err)
+		return ctx
+	}
+	var req pb.RenderRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		glog.Warningf("invalid render request from peer: %v", err)
+		return ctx
+	}
+	return withRenderRequest(ctx, &req)
+}
+
+// peerTransport adds the render request, trace, and request ID from the
+// context to peer fetches
+type peerTransport struct {
+	base http.RoundTripper
+}
+
+func (t peerTransport) RoundTrip(r *http.Request) (resp *http.Response, err error) {
+	ctx, span := tracer().Start(r.Context(), "groupcache.peer", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrPeer.String(r.URL.Host), attribute.String("http.method", r.Method)),
+	)
+	defer func() { endSpan(span, err) }()
+
+	// Counted as a fetch from the owner, unless groupcache falls back to
+	// rendering here when it fails
+	setCacheResult(ctx, cachePeer)
+	r = r.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	if lookupOnly(ctx) {
+		r.Header.Set(PeerLookupHeader, "1")
+	}
+	if id := RequestID(ctx); id != "" {
+		r.Header.Set(RequestIDHeader, id)
+	}
+	req := renderRequestFromContext(ctx)
+	if req == nil {
+		return t.base.RoundTrip(r)
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return t.base.RoundTrip(r)
+	}
+	if v := base64.RawURLEncoding.EncodeToString(b); len(v) <= maxPeerHeaderBytes {
+		r.Header.Set(PeerRequestHeader, v)
+	}
+	return t.base.RoundTrip(r)
+}
+
+type lookupOnlyKey struct{}
+
+// withLookupOnly stops cache fills from rendering, so lookups have no effect
+func withLookupOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lookupOnlyKey{}, true)
+}
+
+func lookupOnly(ctx context.Context) bool {
+	v, _ := ctx.Value(lookupOnlyKey{}).(bool)
+	return v
+}
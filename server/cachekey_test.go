@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCacheKey(t *testing.T) {
+	h := &handler{Renderer: echoRenderer}
+	text := "@startuml\nrectangle Foo\n@enduml"
+	short, _ := ToShort(text)
+	base := &pb.RenderRequest{Diagram: &pb.Diagram{Full: text}, Format: pb.Format_SVG}
+	key := func(req *pb.RenderRequest) string {
+		k, err := h.cacheKey(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return k
+	}
+
+	same := []*pb.RenderRequest{
+		{Diagram: &pb.Diagram{Short: short}, Format: pb.Format_SVG},
+		{Diagram: &pb.Diagram{Full: "\r\n" + strings.ReplaceAll(text, "\n", "\r\n") + "  \n"}, Format: pb.Format_SVG},
+	}
+	for _, req := range same {
+		if key(req) != key(base) {
+			t.Errorf("expected equivalent request to share a key: %v", req)
+		}
+	}
+
+	changes := map[string]func(*pb.RenderRequest){
+		"format":  func(r *pb.RenderRequest) { r.Format = pb.Format_PNG },
+		"layout":  func(r *pb.RenderRequest) { r.Layout = pb.Layout_SMETANA },
+		"version": func(r *pb.RenderRequest) { r.Version = "1.2022.7" },
+		"files":   func(r *pb.RenderRequest) { r.Files = map[string]string{"a.iuml": ""} },
+		"text":    func(r *pb.RenderRequest) { r.Diagram.Full = strings.Replace(text, "Foo", "Bar", 1) },
+	}
+	for name, change := range changes {
+		req := proto.Clone(base).(*pb.RenderRequest)
+		change(req)
+		if key(req) == key(base) {
+			t.Errorf("expected %s to change the key", name)
+		}
+	}
+
+	big := proto.Clone(base).(*pb.RenderRequest)
+	big.Diagram.Full = "@startuml\n" + strings.Repeat("rectangle Foo\n", 10000) + "@enduml"
+	if k := key(big); len(k) != len(key(base)) || len(k) > 64 {
+		t.Errorf("expected a fixed-size key, got %d bytes", len(k))
+	}
+}
+
+func TestDirDigest(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "style.puml"), []byte("v1"), 0644)
+	before := dirDigest(dir)
+
+	// Hidden files, like the include library's history, don't count
+	os.MkdirAll(filepath.Join(dir, ".versions"), 0755)
+	os.WriteFile(filepath.Join(dir, ".versions", "1.puml"), []byte("v1"), 0644)
+	if got := dirDigest(dir); got != before {
+		t.Errorf("expected hidden files to be skipped")
+	}
+
+	os.WriteFile(filepath.Join(dir, "style.puml"), []byte("v2"), 0644)
+	if got := dirDigest(dir); got == before {
+		t.Errorf("expected changed contents to change the digest")
+	}
+}
+
+func TestLibraryFingerprint(t *testing.T) {
+	newLib := func(content string) *IncludeLibrary {
+		lib, err := NewIncludeLibrary(t.TempDir())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := lib.Put("ourcorp/style", []byte(content)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return lib
+	}
+	a, b, c := newLib("v1"), newLib("v1"), newLib("v2")
+
+	// Only managed files count, so other files in the search path are ignored
+	os.WriteFile(filepath.Join(b.Dir, "unrelated.puml"), []byte("x"), 0644)
+	if a.CacheFingerprint() != b.CacheFingerprint() {
+		t.Errorf("expected libraries with the same files to agree")
+	}
+	if a.CacheFingerprint() == c.CacheFingerprint() {
+		t.Errorf("expected changed contents to change the fingerprint")
+	}
+}
+
+// resetDigests forgets cached digests once the test is done
+func resetDigests(t *testing.T) {
+	t.Cleanup(func() {
+		digests.Lock()
+		digests.m = map[string]cachedValue{}
+		digests.Unlock()
+	})
+}
+
+func TestCachedDigestRefreshesInBackground(t *testing.T) {
+	resetDigests(t)
+	key := "test:" + t.Name()
+	var calls int32
+	release := make(chan struct{})
+	compute := func() string {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			<-release
+		}
+		return fmt.Sprint(atomic.LoadInt32(&calls))
+	}
+	if got := cachedDigest(key, compute); got != "1" {
+		t.Fatalf("expected the first call to compute, got %s", got)
+	}
+
+	// Stale values are served while one refresh runs
+	digests.Lock()
+	v := digests.m[key]
+	v.at = v.at.Add(-fingerprintTTL)
+	digests.m[key] = v
+	digests.Unlock()
+	for i := 0; i < 3; i++ {
+		if got := cachedDigest(key, compute); got != "1" {
+			t.Errorf("expected the stale value while refreshing, got %s", got)
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second * 5)
+	for cachedDigest(key, compute) != "2" {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the refreshed value")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected a single refresh, got %d computes", n)
+	}
+}
+
+func TestPeerRequestHeader(t *testing.T) {
+	opts := CachePoolOptions()
+
+	req := &pb.RenderRequest{
+		Diagram: &pb.Diagram{Full: "@startuml\nrectangle Foo\n@enduml"},
+		Format:  pb.Format_PNG,
+		Files:   map[string]string{"a.iuml": "x"},
+	}
+	var got *pb.RenderRequest
+	var gotLookup bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := opts.Context(r)
+		got = renderRequestFromContext(ctx)
+		gotLookup = lookupOnly(ctx)
+	}))
+	defer srv.Close()
+
+	ctx := withRenderRequest(context.Background(), req)
+	httpReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := opts.Transport(ctx).RoundTrip(httpReq)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if !proto.Equal(got, req) {
+		t.Errorf("expected peer to recover %v, got %v", req, got)
+	}
+	if gotLookup {
+		t.Errorf("expected a render, not a lookup")
+	}
+
+	ctx = withLookupOnly(ctx)
+	httpReq, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err = opts.Transport(ctx).RoundTrip(httpReq)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if !gotLookup {
+		t.Errorf("expected peer to see a lookup")
+	}
+}
+
+func TestRenderCache(t *testing.T) {
+	var renders int32
+	h := &handler{
+		Cache: NewGroupCache(testGroupName(t), 1<<20),
+		Renderer: RendererFunc(func(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+			atomic.AddInt32(&renders, 1)
+			return [][]byte{[]byte(text)}, nil
+		}),
+	}
+
+	req := &pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml\n!include a.iuml\n@enduml"}, Format: pb.Format_SVG}
+	for i := 0; i < 2; i++ {
+		if _, err := h.Render(context.Background(), req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if renders != 1 {
+		t.Errorf("expected a cache hit, got %d renders", renders)
+	}
+
+	// Include files are part of the key
+	req.Files = map[string]string{"a.iuml": "rectangle Foo"}
+	if _, err := h.Render(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if renders != 2 {
+		t.Errorf("expected a render for new include files, got %d renders", renders)
+	}
+
+	// Lookups don't render
+	key, _ := h.requestKey(context.Background(), req)
+	if ok, err := h.Cache.(*GroupCache).Contains(context.Background(), key); !ok || err != nil {
+		t.Errorf("expected key to be cached: %v", err)
+	}
+	missing := proto.Clone(req).(*pb.RenderRequest)
+	missing.Format = pb.Format_PNG
+	lookup, err := h.LookupCache(context.Background(), &pb.LookupCacheRequest{Request: missing})
+	if err != nil || lookup.Cached {
+		t.Errorf("expected a miss without error, got %v: %v", lookup, err)
+	}
+	if renders != 2 {
+		t.Errorf("expected lookups not to render, got %d renders", renders)
+	}
+
+	if _, err := h.PurgeCache(context.Background(), &pb.PurgeCacheRequest{Keys: []string{key}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := h.Render(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if renders != 3 {
+		t.Errorf("expected a render after purging, got %d renders", renders)
+	}
+
+	stats, _ := h.GetCacheStats(context.Background(), &pb.GetCacheStatsRequest{})
+	if stats.Group.GetCacheHits() != 2 || len(stats.Caches) != 2 || stats.Caches[0].Name != "main" {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+
+	// Keys can't be used without the request
+	key, _ = h.cacheKey(&pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml\n@enduml"}, Format: pb.Format_SVG})
+	if _, err := h.Cache.Get(context.Background(), key, h.fillCache); err == nil {
+		t.Errorf("expected an error for a key without its request")
+	}
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/golang/glog"
+)
+
+// DiskCache keeps render results on disk so they survive restarts
+//
+// It's a second tier behind groupcache: consulted before rendering, and filled
+// after. Entries are evicted least-recently-used once the total passes
+// MaxBytes. Every entry carries a checksum, so a torn or corrupted file is a
+// miss rather than a broken image.
+//
+// Recency is kept in file modification times, so it carries across restarts
+// too. Only one process should use a Dir at a time.
+type DiskCache struct {
+	Dir      string
+	MaxBytes int64
+
+	mu        sync.Mutex
+	size      int64
+	order     *list.List // of *diskEntry, most recent first
+	entries   map[string]*list.Element
+	gets      int64
+	hits      int64
+	evictions int64
+}
+
+type diskEntry struct {
+	key  string
+	size int64
+}
+
+// Written before each entry, followed by the sha256 of the data
+var (
+	diskCacheMagic  = []byte("pmlproxy-cache-v1\n")
+	diskCacheHeader = len(diskCacheMagic) + sha256.Size
+)
+
+// NewDiskCache creates dir if needed and indexes the entries already in it
+//
+// Leftovers from interrupted writes are removed, and the oldest entries are
+// evicted if dir is over maxBytes.
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("disk cache size must be positive: %d", maxBytes)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create disk cache: %w", err)
+	}
+
+	type found struct {
+		diskEntry
+		mtime time.Time
+	}
+	var all []found
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			os.Remove(path)
+			return nil
+		}
+		if !cacheKeyFormat.MatchString(d.Name()) || path != filepath.Join(dir, d.Name()[:2], d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		all = append(all, found{diskEntry{d.Name(), info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read disk cache: %w", err)
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].mtime.After(all[j].mtime) })
+	c := &DiskCache{
+		Dir:      dir,
+		MaxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element, len(all)),
+	}
+	for _, f := range all {
+		e := f.diskEntry
+		c.entries[e.key] = c.order.PushBack(&e)
+		c.size += e.size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	glog.Infof("disk cache has %d entries, %d bytes: %s", c.order.Len(), c.size, dir)
+	return c, nil
+}
+
+// path spreads entries over subdirectories so none get too large
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// Get returns the data stored for key, if it's there and intact
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	if !cacheKeyFormat.MatchString(key) {
+		return nil, false
+	}
+	c.mu.Lock()
+	c.gets++
+	_, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	path := c.path(key)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		glog.Warningf("unable to read disk cache entry %s: %v", key, err)
+		c.Remove(key)
+		return nil, false
+	}
+	data, err := decodeDiskEntry(raw)
+	if err != nil {
+		glog.Warningf("dropping disk cache entry %s: %v", key, err)
+		c.Remove(key)
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	c.mu.Lock()
+	c.hits++
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	return data, true
+}
+
+// Put stores data for key, evicting old entries to make room
+//
+// Entries bigger than MaxBytes aren't stored.
+func (c *DiskCache) Put(key string, data []byte) error {
+	if !cacheKeyFormat.MatchString(key) {
+		return fmt.Errorf("invalid disk cache key: %q", key)
+	}
+	raw := encodeDiskEntry(data)
+	size := int64(len(raw))
+	if size > c.MaxBytes {
+		return nil
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*diskEntry)
+		c.size += size - e.size
+		e.size = size
+		c.order.MoveToFront(el)
+	} else {
+		c.entries[key] = c.order.PushFront(&diskEntry{key, size})
+		c.size += size
+	}
+	c.evict()
+	return nil
+}
+
+// Size returns the bytes used by entries, including headers
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Len returns the number of entries
+func (c *DiskCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *DiskCache) Stats() *pb.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &pb.CacheStats{
+		Name:      "disk",
+		Bytes:     c.size,
+		Items:     int64(c.order.Len()),
+		Gets:      c.gets,
+		Hits:      c.hits,
+		Evictions: c.evictions,
+	}
+}
+
+// Contains reports whether key has an entry, without checking it's intact
+func (c *DiskCache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	return ok
+}
+
+// Remove forgets key and deletes its file
+func (c *DiskCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// evict drops least-recently-used entries until under MaxBytes. Needs c.mu.
+func (c *DiskCache) evict() {
+	for c.size > c.MaxBytes {
+		el := c.order.Back()
+		if el == nil {
+			return
+		}
+		c.removeElement(el)
+		c.evictions++
+	}
+}
+
+// removeElement needs c.mu
+func (c *DiskCache) removeElement(el *list.Element) {
+	e := el.Value.(*diskEntry)
+	c.order.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	if err := removeIfExists(c.path(e.key)); err != nil {
+		glog.Errorf("unable to remove disk cache entry %s: %v", e.key, err)
+	}
+}
+
+func encodeDiskEntry(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	raw := make([]byte, 0, diskCacheHeader+len(data))
+	raw = append(raw, diskCacheMagic...)
+	raw = append(raw, sum[:]...)
+	return append(raw, data...)
+}
+
+var errDiskChecksum = errors.New("checksum mismatch")
+
+func decodeDiskEntry(raw []byte) ([]byte, error) {
+	if len(raw) < diskCacheHeader || !bytes.HasPrefix(raw, diskCacheMagic) {
+		return nil, errors.New("not a cache entry")
+	}
+	sum := raw[len(diskCacheMagic):diskCacheHeader]
+	data := raw[diskCacheHeader:]
+	if got := sha256.Sum256(data); !bytes.Equal(got[:], sum) {
+		return nil, errDiskChecksum
+	}
+	return data, nil
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coxley/pmlproxy/pb"
+)
+
+func diskKey(i int) string {
+	return fmt.Sprintf("%064x", i)
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := c.Get(diskKey(1)); ok {
+		t.Errorf("expected a miss on an empty cache")
+	}
+	if err := c.Put(diskKey(1), []byte("one")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, ok := c.Get(diskKey(1)); !ok || string(got) != "one" {
+		t.Errorf("expected %q, got %q (hit: %v)", "one", got, ok)
+	}
+
+	// Keys are file names, so only digests are allowed
+	for _, key := range []string{"../../etc/passwd", "ABCDEF0123", ""} {
+		if err := c.Put(key, []byte("x")); err == nil {
+			t.Errorf("expected invalid key %q to be rejected", key)
+		}
+	}
+
+	// Survives a restart
+	c, err = NewDiskCache(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, ok := c.Get(diskKey(1)); !ok || string(got) != "one" {
+		t.Errorf("expected %q after reopening, got %q (hit: %v)", "one", got, ok)
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 100)
+	entry := int64(len(encodeDiskEntry(data)))
+	c, err := NewDiskCache(t.TempDir(), entry*3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		c.Put(diskKey(i), data)
+	}
+	// Recently read entries are kept over older writes
+	c.Get(diskKey(0))
+	c.Put(diskKey(3), data)
+
+	if _, ok := c.Get(diskKey(1)); ok {
+		t.Errorf("expected least recently used entry to be evicted")
+	}
+	for _, i := range []int{0, 2, 3} {
+		if _, ok := c.Get(diskKey(i)); !ok {
+			t.Errorf("expected entry %d to be kept", i)
+		}
+	}
+	if c.Len() != 3 || c.Size() != entry*3 {
+		t.Errorf("expected 3 entries in %d bytes, got %d in %d", entry*3, c.Len(), c.Size())
+	}
+	if _, err := os.Stat(c.path(diskKey(1))); !os.IsNotExist(err) {
+		t.Errorf("expected evicted entry's file to be removed: %v", err)
+	}
+
+	// Shrinking the limit evicts on open
+	c, err = NewDiskCache(c.Dir, entry)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("expected 1 entry after reopening smaller, got %d", c.Len())
+	}
+}
+
+func TestDiskCacheCorruption(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Put(diskKey(1), []byte("intact"))
+	c.Put(diskKey(2), []byte("intact"))
+
+	raw, _ := os.ReadFile(c.path(diskKey(1)))
+	raw[len(raw)-1] ^= 0xff
+	os.WriteFile(c.path(diskKey(1)), raw, 0600)
+	os.WriteFile(c.path(diskKey(2)), raw[:10], 0600)
+
+	for _, i := range []int{1, 2} {
+		if got, ok := c.Get(diskKey(i)); ok {
+			t.Errorf("expected corrupt entry %d to miss, got %q", i, got)
+		}
+		if _, err := os.Stat(c.path(diskKey(i))); !os.IsNotExist(err) {
+			t.Errorf("expected corrupt entry %d to be removed: %v", i, err)
+		}
+	}
+
+	// Interrupted writes are cleaned up on open
+	tmp := filepath.Join(dir, "00", ".tmp-123")
+	os.MkdirAll(filepath.Dir(tmp), 0700)
+	os.WriteFile(tmp, []byte("partial"), 0600)
+	if _, err := NewDiskCache(dir, 1<<20); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("expected leftover temp file to be removed: %v", err)
+	}
+}
+
+func TestDiskRender(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var renders int32
+	renderer := RendererFunc(func(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+		atomic.AddInt32(&renders, 1)
+		if strings.Contains(text, "fail") {
+			return nil, fmt.Errorf("syntax error")
+		}
+		return [][]byte{[]byte(text)}, nil
+	})
+
+	req := &pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml\nrectangle Foo\n@enduml"}, Format: pb.Format_SVG}
+	for i := 0; i < 2; i++ {
+		// A fresh handler each time, like after a restart
+		h := &handler{Renderer: renderer, DiskCache: cache}
+		resp, err := h.Render(context.Background(), req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(resp.Data) != 1 || !strings.Contains(string(resp.Data[0]), "rectangle Foo") {
+			t.Errorf("unexpected response: %v", resp)
+		}
+	}
+	if renders != 1 {
+		t.Errorf("expected a disk cache hit, got %d renders", renders)
+	}
+
+	// Failures aren't stored
+	h := &handler{Renderer: renderer, DiskCache: cache}
+	fail := &pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml\nfail\n@enduml"}, Format: pb.Format_SVG}
+	for i := 0; i < 2; i++ {
+		if _, err := h.Render(context.Background(), fail); err == nil {
+			t.Errorf("expected an error")
+		}
+	}
+	if renders != 3 {
+		t.Errorf("expected failed renders to be retried, got %d renders", renders)
+	}
+}
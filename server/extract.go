@@ -6,9 +6,14 @@ import (
 	"encoding/binary"
 	"encoding/xml"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"regexp"
 	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // 89 50 4E 47 0D 0A 1A 0A
@@ -222,3 +227,153 @@ func divideMetadata(s string) (string, string) {
 	}
 	return s[:lastLineEnd], s[lastLineEnd:]
 }
+
+// sourceSwaps maps lines of the text we render back to the lines sent to us
+//
+// Request files and library includes are rewritten to paths on this server.
+// PlantUML embeds the text it renders in images, so restoreSource swaps the
+// lines back before images leave. Returns nil if nothing was rewritten.
+func sourceSwaps(sent, rendered string) map[string]string {
+	from, to := strings.Split(sent, "\n"), strings.Split(rendered, "\n")
+	if len(from) != len(to) {
+		return nil
+	}
+	var swaps map[string]string
+	for i := range from {
+		if from[i] == to[i] {
+			continue
+		}
+		if swaps == nil {
+			swaps = make(map[string]string)
+		}
+		swaps[to[i]] = from[i]
+	}
+	return swaps
+}
+
+// restoreSource puts the lines in swaps back into each page's diagram text
+//
+// Images without PlantUML's metadata are returned unchanged.
+func restoreSource(pages [][]byte, swaps map[string]string) ([][]byte, error) {
+	if len(swaps) == 0 {
+		return pages, nil
+	}
+	for i, img := range pages {
+		img, err := restoreImage(img, swaps)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to restore diagram text in page %d: %v", i+1, err)
+		}
+		pages[i] = img
+	}
+	return pages, nil
+}
+
+func restoreImage(img []byte, swaps map[string]string) ([]byte, error) {
+	if bytes.HasPrefix(img, []byte(pngHeader)) {
+		return restorePNG(img, swaps)
+	}
+	if bytes.Contains(img, []byte("<svg")) {
+		return restoreSVG(img, swaps)
+	}
+	return img, nil
+}
+
+// swapLines replaces whole lines of text found in swaps
+func swapLines(text string, swaps map[string]string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSuffix(line, "\r")
+		if orig, ok := swaps[trimmed]; ok {
+			lines[i] = orig + line[len(trimmed):]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// restorePNG rewrites the plantuml iTXt chunk, see FromPNG
+func restorePNG(img []byte, swaps map[string]string) ([]byte, error) {
+	pos := len(pngHeader)
+	for pos+8 <= len(img) {
+		length := int(binary.BigEndian.Uint32(img[pos:]))
+		ctype := string(img[pos+4 : pos+8])
+		end := pos + 8 + length + 4
+		if length < 0 || end > len(img) {
+			return nil, fmt.Errorf("truncated %s chunk in png", ctype)
+		}
+		data := img[pos+8 : pos+8+length]
+		if ctype == "IEND" {
+			break
+		}
+		if ctype != "iTXt" || !bytes.HasPrefix(data, keyword) || len(data) < len(keyword)+offset {
+			pos = end
+			continue
+		}
+
+		zr, err := zlib.NewReader(bytes.NewReader(data[len(keyword)+offset:]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zlib reader: %v", err)
+		}
+		metadata, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode metadata: %v", err)
+		}
+
+		var chunk bytes.Buffer
+		chunk.Write(data[:len(keyword)+offset])
+		zw := zlib.NewWriter(&chunk)
+		zw.Write([]byte(swapLines(string(metadata), swaps)))
+		zw.Close()
+
+		var res bytes.Buffer
+		res.Write(img[:pos])
+		buf := make([]byte, 4)
+		binary.BigEndian.PutUint32(buf, uint32(chunk.Len()))
+		res.Write(buf)
+		crc := crc32.NewIEEE()
+		crc.Write([]byte(ctype))
+		crc.Write(chunk.Bytes())
+		res.WriteString(ctype)
+		res.Write(chunk.Bytes())
+		binary.BigEndian.PutUint32(buf, crc.Sum32())
+		res.Write(buf)
+		res.Write(img[end:])
+		return res.Bytes(), nil
+	}
+	return img, nil
+}
+
+var svgSource = regexp.MustCompile(`<\?plantuml-src (\S+)\?>`)
+
+// restoreSVG rewrites the source comment, see FromSVG, and the encoded copy
+// newer PlantUML versions keep in a processing instruction
+func restoreSVG(img []byte, swaps map[string]string) ([]byte, error) {
+	// Comments can't hold "--", so PlantUML spaces them out
+	spaced := make(map[string]string, len(swaps))
+	for from, to := range swaps {
+		spaced[spaceDashes(from)] = spaceDashes(to)
+	}
+	text := swapLines(string(img), spaced)
+
+	var err error
+	text = svgSource.ReplaceAllStringFunc(text, func(pi string) string {
+		src, decodeErr := FromShort(svgSource.FindStringSubmatch(pi)[1])
+		if decodeErr != nil {
+			err = fmt.Errorf("failed to decode plantuml-src: %v", decodeErr)
+			return pi
+		}
+		short, encodeErr := ToShort(swapLines(src, swaps))
+		if encodeErr != nil {
+			err = fmt.Errorf("failed to encode plantuml-src: %v", encodeErr)
+			return pi
+		}
+		return "<?plantuml-src " + short + "?>"
+	})
+	return []byte(text), err
+}
+
+func spaceDashes(s string) string {
+	for strings.Contains(s, "--") {
+		s = strings.ReplaceAll(s, "--", "- -")
+	}
+	return s
+}
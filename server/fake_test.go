@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coxley/pmlproxy/fakeplantuml"
+)
+
+// Set for re-executions of the test binary that should act as PlantUML
+const fakeEnv = "PMLPROXY_FAKEPLANTUML"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeEnv) != "" {
+		os.Exit(fakeplantuml.Main(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	// Inherited by workers, which re-execute this binary
+	os.Setenv(fakeEnv, "1")
+	os.Exit(m.Run())
+}
+
+// fakePool returns a pool whose workers are fakeplantuml processes
+//
+// Extra args are passed to the fake, eg. -fake-fail-start.
+func fakePool(tb testing.TB, args ...string) *WorkerPool {
+	tb.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		tb.Fatalf("can't find test binary: %v", err)
+	}
+	wp := NewWorkerPool()
+	wp.Workers = 1
+	wp.JavaExe = exe
+	wp.PlantUMLPath = ""
+	wp.RenderTimeout = time.Second * 5
+	wp.WorkerArgs = append([]string{"-pipe"}, args...)
+	// Answers "dot -V", so tests don't depend on Graphviz being installed
+	wp.GraphvizDot = "true"
+	return wp
+}
+
+// runPool runs wp until the test ends, waiting for it to be ready
+func runPool(tb testing.TB, wp *WorkerPool) {
+	tb.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	tb.Cleanup(cancel)
+	go wp.Run(ctx)
+	waitReady(tb, wp)
+}
+
+// waitReady fails the test if wp isn't ready within 10s
+func waitReady(tb testing.TB, wp *WorkerPool) {
+	tb.Helper()
+	deadline := time.Now().Add(time.Second * 10)
+	for !wp.Ready() {
+		if time.Now().After(deadline) {
+			tb.Fatalf("pool wasn't ready after 10s")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// fakeHandler returns a handler rendering with a running fake pool
+func fakeHandler(tb testing.TB) *handler {
+	tb.Helper()
+	h := &handler{WorkerPool: *fakePool(tb)}
+	runPool(tb, &h.WorkerPool)
+	return h
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limits on RenderRequest.Files, so one request can't fill the disk
+const (
+	maxRequestFiles     = 256
+	maxRequestFileBytes = 8 * 1024 * 1024
+)
+
+// checkRequestFiles rejects file names that would escape the sandbox
+func checkRequestFiles(files map[string]string) error {
+	if len(files) > maxRequestFiles {
+		return status.Errorf(codes.InvalidArgument, "too many include files: %d > %d", len(files), maxRequestFiles)
+	}
+	var size int
+	seen := make(map[string]bool, len(files))
+	for name, content := range files {
+		clean := cleanFileName(name)
+		if clean == "" {
+			return status.Errorf(codes.InvalidArgument, "invalid include file name %q: must be relative without '..'", name)
+		}
+		if seen[clean] {
+			return status.Errorf(codes.InvalidArgument, "include file %q given more than once", clean)
+		}
+		seen[clean] = true
+		size += len(content)
+	}
+	if size > maxRequestFileBytes {
+		return status.Errorf(codes.InvalidArgument, "include files too large: %d > %d bytes", size, maxRequestFileBytes)
+	}
+	return nil
+}
+
+// cleanFileName returns name in canonical form, or "" if it isn't local
+func cleanFileName(name string) string {
+	if name == "" || filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return ""
+	}
+	clean := filepath.ToSlash(filepath.Clean(name))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return ""
+	}
+	return clean
+}
+
+// filesDigest identifies a set of files for cache keys, "" if there are none
+func filesDigest(files map[string]string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	clean := make(map[string]string, len(files))
+	names := make([]string, 0, len(files))
+	for name, content := range files {
+		name = cleanFileName(name)
+		clean[name] = content
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	size := make([]byte, 8)
+	for _, name := range names {
+		// Lengths keep ("ab", "c") and ("a", "bc") apart
+		for _, s := range []string{name, clean[name]} {
+			binary.BigEndian.PutUint64(size, uint64(len(s)))
+			h.Write(size)
+			h.Write([]byte(s))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// filesRoot is where each render's files get a directory
+func (h *handler) filesRoot() string {
+	dir := h.FilesDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "pmlproxy-files")
+}
+
+// writeRequestFiles puts files in a new directory, returning it and a clean-up
+func (h *handler) writeRequestFiles(files map[string]string) (string, func(), error) {
+	root := h.filesRoot()
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp(root, "render-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			glog.Errorf("failed to remove include files: %v", err)
+		}
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(cleanFileName(name)))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	return dir, cleanup, nil
+}
+
+var relativeInclude = regexp.MustCompile(`^(\s*!include\w*\s+)([^<!\s][^!\s]*)(.*)$`)
+
+// rewriteIncludes points includes of request files at where they were written
+//
+// Only the diagram needs rewriting. PlantUML resolves includes inside the
+// files relative to the including file, which is already in dir. Images get
+// the original lines back, see sourceSwaps.
+func rewriteIncludes(text string, files map[string]string, dir string) string {
+	names := make(map[string]bool, len(files))
+	for name := range files {
+		names[cleanFileName(name)] = true
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		m := relativeInclude.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name := cleanFileName(strings.Trim(m[2], `"`))
+		if name == "" || !names[name] {
+			continue
+		}
+		lines[i] = m[1] + filepath.Join(dir, filepath.FromSlash(name)) + m[3]
+	}
+	return strings.Join(lines, "\n")
+}
+
+type renderRequestKey struct{}
+
+// withRenderRequest lets the cache getter see what the cache key can't hold
+func withRenderRequest(ctx context.Context, req *pb.RenderRequest) context.Context {
+	return context.WithValue(ctx, renderRequestKey{}, req)
+}
+
+func renderRequestFromContext(ctx context.Context) *pb.RenderRequest {
+	req, _ := ctx.Value(renderRequestKey{}).(*pb.RenderRequest)
+	return req
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckRequestFiles(t *testing.T) {
+	for _, name := range []string{"common.iuml", "./lib/macros.iuml", "a/../b.iuml"} {
+		if err := checkRequestFiles(map[string]string{name: ""}); err != nil {
+			t.Errorf("%q: unexpected error: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "../common.iuml", "a/../../b", "/etc/passwd"} {
+		err := checkRequestFiles(map[string]string{name: ""})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%q: expected InvalidArgument, got: %v", name, err)
+		}
+	}
+	err := checkRequestFiles(map[string]string{"a.iuml": "x", "./a.iuml": "y"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for duplicate names, got: %v", err)
+	}
+}
+
+func TestFilesDigest(t *testing.T) {
+	a := filesDigest(map[string]string{"a.iuml": "x", "b.iuml": "y"})
+	if b := filesDigest(map[string]string{"./b.iuml": "y", "a.iuml": "x"}); a != b {
+		t.Errorf("expected equivalent files to match, got %s and %s", a, b)
+	}
+	if b := filesDigest(map[string]string{"a.iuml": "x", "b.iuml": "z"}); a == b {
+		t.Errorf("expected different contents to change the digest")
+	}
+	if b := filesDigest(map[string]string{"a.iumlx": "", "b.iuml": "y"}); a == b {
+		t.Errorf("expected name/content boundaries to change the digest")
+	}
+	if d := filesDigest(nil); d != "" {
+		t.Errorf("expected no files to have an empty digest, got %s", d)
+	}
+}
+
+func TestRequestFiles(t *testing.T) {
+	files := map[string]string{
+		"common.iuml":     "!include lib/colors.iuml",
+		"lib/colors.iuml": "!$color = red",
+	}
+	var seen string
+	h := &handler{
+		FilesDir: t.TempDir(),
+		Renderer: RendererFunc(func(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+			seen = text
+			// Files are in place while rendering
+			for _, line := range strings.Split(text, "\n") {
+				if path := strings.TrimPrefix(line, "!include /"); path != line {
+					path = "/" + path
+					if _, err := os.Stat(path); err != nil {
+						t.Errorf("expected %s to exist: %v", path, err)
+					}
+				}
+			}
+			return [][]byte{[]byte(text)}, nil
+		}),
+	}
+
+	_, err := h.Render(context.Background(), &pb.RenderRequest{
+		Diagram: &pb.Diagram{Full: "@startuml\n!include common.iuml\n!include <C4/C4>\n@enduml"},
+		Format:  pb.Format_SVG,
+		Files:   files,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(seen, "\n")
+	if !strings.HasPrefix(lines[1], "!include "+h.filesRoot()) || !strings.HasSuffix(lines[1], "/common.iuml") {
+		t.Errorf("expected include to be rewritten, got: %s", lines[1])
+	}
+	if lines[2] != "!include <C4/C4>" {
+		t.Errorf("expected stdlib include to be left alone, got: %s", lines[2])
+	}
+	entries, _ := os.ReadDir(h.filesRoot())
+	if len(entries) != 0 {
+		t.Errorf("expected files to be removed after rendering, found %d", len(entries))
+	}
+
+	// Files are checked like the diagram
+	h.Security = &SecurityPolicy{}
+	files["lib/colors.iuml"] = "!include /etc/passwd"
+	_, err = h.Render(context.Background(), &pb.RenderRequest{
+		Diagram: &pb.Diagram{Full: "@startuml\n!include common.iuml\n@enduml"},
+		Format:  pb.Format_SVG,
+		Files:   files,
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got: %v", err)
+	}
+}
+
+func TestRequestFilesExtract(t *testing.T) {
+	h := fakeHandler(t)
+	h.FilesDir = t.TempDir()
+
+	// The temporary directory is gone by the time anyone extracts this
+	text := "@startuml\n!include common.iuml\nrectangle Foo\n@enduml"
+	for _, format := range []pb.Format{pb.Format_PNG, pb.Format_SVG} {
+		res, err := h.Render(context.Background(), &pb.RenderRequest{
+			Diagram: &pb.Diagram{Full: text},
+			Format:  format,
+			Files:   map[string]string{"common.iuml": "skinparam monochrome true"},
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		ex, err := h.Extract(context.Background(), &pb.ExtractRequest{Data: res.Data[0]})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if got := ex.Diagram.Full; got != text {
+			t.Errorf("%s: expected %q, got %q", format, text, got)
+		}
+	}
+}
@@ -2,16 +2,15 @@ package server
 
 import (
 	"context"
-	"fmt"
-	"runtime"
 	"strings"
 	"time"
 
 	"github.com/coxley/pmlproxy/pb"
 	"github.com/golang/glog"
-	"github.com/golang/groupcache"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type Handler interface {
@@ -19,213 +18,449 @@ type Handler interface {
 	ManageWorkers(ctx context.Context)
 }
 
+// handlerReady asks h whether enough workers are warm to accept traffic
+//
+// Handlers without a Ready() method are always ready.
+func handlerReady(h Handler) bool {
+	if r, ok := h.(interface{ Ready() bool }); ok {
+		return r.Ready()
+	}
+	return true
+}
+
 type handler struct {
 	pb.PlantUMLServer
+	pb.AdminServer
 
-	// How many PlantUML sub-processes should we create to handle the rendering?
+	// Pool of PlantUML processes, used unless Renderer is set.
+	WorkerPool
+
+	// Backend that turns diagrams into images (default: WorkerPool)
 	//
-	// Each worker spins up a goroutine that manages and reads from the sub-process.
-	Workers int
+	// ManageWorkers only runs the embedded WorkerPool when this is nil.
+	// Custom renderers are responsible for their own lifecycle.
+	Renderer Renderer
 
-	// Command-line args to Java and PlantUML (default: h.MakeWorkerArgs())
+	// Named PlantUML versions, each with its own pool (default: none)
 	//
-	// Crafting your own arguments instead of amending the default ones may
-	// break assumptions. Create a Handler, then set this field ho
-	// h.MakeWorkerArgs() + your changes.
-	WorkerArgs []string
+	// When set, requests pick one by name and the embedded WorkerPool and
+	// Renderer are unused. See WorkerPool.WithPlantUML.
+	Versions map[string]*WorkerPool
+
+	// Version for requests that don't ask for one (default: newest in Versions)
+	DefaultVersion string
 
-	// Upper bound to wait for a digram to render (default: 10s)
+	// Limits what diagrams can include from disk and the network (default: nil, no checks)
 	//
-	// Set high enough to only cancel problematic
-	// payloads. Value will vary based on configured workers and available
-	// CPU.
-	RenderTimeout time.Duration
+	// ManageWorkers adds the policy's PlantUML security profile to the
+	// JavaOptions of every pool it runs, and runs them from its IncludeDir.
+	Security *SecurityPolicy
+
+	// Shared files that diagrams can !include by name (default: nil, disabled)
+	Library *IncludeLibrary
 
-	// Delimeter between diagrams over the PlantUML pipe (default: XXXPUMLXXX)
+	// Where files sent with requests are written (default: os.TempDir())
+	FilesDir string
+
+	// Wraps the Renderer to add behaviour like metrics or retries.
 	//
-	// Pick something that won't appear in your diagram text (more important for SVG).
-	PipeDelimiter string
+	// The first middleware is the outermost.
+	Middleware []Middleware
 
-	// Where will PlantUML look to import local themes, plugins, etc?
+	// Stores render results by cache key (default: nil, no caching)
 	//
-	// We will ensure the path exists, failing-hard without the correct privileges.
-	SearchPath string
+	// See GroupCache, LRUCache, and NoCache.
+	Cache RenderCache
 
-	// Path to the Java binary. (default: "java" in $PATH)
-	JavaExe string
+	// Keeps render results on disk, behind Cache (default: nil, disabled)
+	DiskCache *DiskCache
 
-	// Path to the Java binary. (default: "/usr/share/java/plantuml/plantuml.jar")
-	PlantUMLPath string
+	// Honours RenderRequest.BypassCache (default: false, refused)
+	//
+	// Bypassing skips the caches that keep repeat renders off the workers,
+	// so only allow it when callers are trusted.
+	AllowBypassCache bool
 
-	// Will store render results in the cache if set.
+	// Diagrams to render into the cache once workers are ready (default: "", none)
 	//
-	// Note: You MUST take care of managing the groupcache pool yourself. See
-	// github.com/mailgun/groupcache for a valid example.
-	GroupCache      bool
-	GroupCacheBytes int64
-	renderGroup     *groupcache.Group
+	// See Prefill for which files are used.
+	PrefillDir string
+
+	// Formats .puml files in PrefillDir are rendered as (default: DefaultPrefillFormats)
+	PrefillFormats []pb.Format
 
-	workerCh chan workerReq
+	prefilling int32 // atomic
 }
 
 var DefaultHandler = handler{
-	Workers:         runtime.NumCPU(),
-	RenderTimeout:   time.Second * 10,
-	JavaExe:         "java",
-	PlantUMLPath:    "/usr/share/java/plantuml/plantuml.jar",
-	SearchPath:      ".",
-	PipeDelimiter:   "XXXPUMLXXX",
-	GroupCacheBytes: 10000000, // 10MB
-	workerCh:        make(chan workerReq),
+	WorkerPool: *NewWorkerPool(),
 }
 
-func (h *handler) GetWorkerArgs() []string {
-	if len(h.WorkerArgs) > 0 {
-		return h.WorkerArgs
+// fillCache renders on a cache miss
+//
+// Keys are a digest, so the request comes from the context. Groupcache peers
+// get it from a header, see CachePoolOptions.
+func (h *handler) fillCache(ctx context.Context, key string) (resp *pb.RenderResponse, err error) {
+	glog.V(2).Infof("cache fill: %s", logFields(ctx, "key", key))
+	setCacheResult(ctx, cacheMiss)
+	ctx, span := tracer().Start(ctx, "cache.fill", trace.WithAttributes(attrCacheKey.String(key)))
+	defer func() { endSpan(span, err) }()
+
+	req := renderRequestFromContext(ctx)
+	if req == nil {
+		return nil, status.Error(codes.FailedPrecondition, "render request for cache key isn't available")
+	}
+	if k, err := h.cacheKey(req); err != nil || k != key {
+		// Eg. a peer with a different jar. Groupcache falls back to
+		// rendering on the server the request came in on.
+		return nil, status.Error(codes.FailedPrecondition, "render request doesn't match cache key")
 	}
-	return h.MakeWorkerArgs()
+	return h.diskRender(ctx, key, req)
 }
 
-func (h *handler) MakeWorkerArgs() []string {
-	return []string{
-		fmt.Sprintf(`-Dplantuml.include.path="%s"`, h.SearchPath),
-		"-jar",
-		h.PlantUMLPath,
-		"-headless",
-		"-pipe",
-		"-pipedelimitor",
-		h.PipeDelimiter,
+// ManageWorkers runs the embedded WorkerPool unless a custom Renderer is set
+//
+// Pools in Versions are run instead of either, if there are any.
+//
+// Returns only when ctx is done.
+func (h *handler) ManageWorkers(ctx context.Context) {
+	// Registered up-front so peers can fetch from us before our first request
+	if c, ok := h.Cache.(*GroupCache); ok {
+		if _, err := c.register(h.fillCache); err != nil {
+			glog.Errorf("unable to set up render cache: %v", err)
+		}
+	}
+	if h.PrefillDir != "" {
+		go h.prefillWhenReady(ctx)
+	}
+	if h.Security != nil {
+		for _, wp := range h.pools() {
+			if len(wp.WorkerArgs) > 0 {
+				glog.Warningf("custom worker args in use, plantuml security profile must be set in them")
+			}
+			// Copied since pools made by WithPlantUML share the original slice
+			opts := h.Security.javaOptions(h.filesRoot())
+			wp.JavaOptions = append(append([]string{}, wp.JavaOptions...), opts...)
+			if wp.Dir == "" {
+				wp.Dir = h.Security.IncludeDir
+			}
+		}
+	}
+	// Walks the include directory now rather than on the first request
+	for _, wp := range h.pools() {
+		go wp.CacheFingerprint()
+	}
+	if len(h.Versions) > 0 {
+		for _, name := range sortedVersions(h.Versions) {
+			glog.Infof("starting workers for plantuml version %s: %s", name, h.Versions[name].PlantUMLPath)
+			go h.Versions[name].Run(ctx)
+		}
+		<-ctx.Done()
+		return
 	}
+	if h.Renderer == nil {
+		h.WorkerPool.Run(ctx)
+		return
+	}
+	<-ctx.Done()
 }
 
-func (h *handler) makeRenderCache() *groupcache.Group {
-	group := groupcache.NewGroup("render", h.GroupCacheBytes, groupcache.GetterFunc(
-		func(ctx context.Context, id string, dest groupcache.Sink) error {
-			glog.Infof("cache getter: %v", id)
-			// id example: SVG:encodedtext
-			s := strings.SplitN(id, ":", 2)
-			if len(s) != 2 {
-				return fmt.Errorf("cache key has wrong format: %v", id)
+// Ready defers to the Renderer, if it has an opinion
+//
+// With Versions, every pool must be ready so that pinned requests don't fail.
+func (h *handler) Ready() bool {
+	if len(h.Versions) > 0 {
+		for _, wp := range h.Versions {
+			if !wp.Ready() {
+				return false
 			}
+		}
+		return true
+	}
+	if h.Renderer == nil {
+		return h.WorkerPool.Ready()
+	}
+	if r, ok := h.Renderer.(interface{ Ready() bool }); ok {
+		return r.Ready()
+	}
+	return true
+}
 
-			fstr, short := s[0], s[1]
-			resp, err := h.directRender(ctx, &pb.RenderRequest{
-				Diagram: &pb.Diagram{Short: short},
-				Format:  pb.Format(pb.Format_value[fstr]),
-			})
-			if err != nil {
-				return err
-			}
-			if err := dest.SetProto(resp); err != nil {
-				return err
-			}
-			return nil
-		},
-	))
-	return group
+// pools returns the worker pools ManageWorkers is responsible for
+func (h *handler) pools() []*WorkerPool {
+	if len(h.Versions) > 0 {
+		var res []*WorkerPool
+		for _, name := range sortedVersions(h.Versions) {
+			res = append(res, h.Versions[name])
+		}
+		return res
+	}
+	if h.Renderer == nil {
+		return []*WorkerPool{&h.WorkerPool}
+	}
+	return nil
 }
 
-// ManageWorkers initiates and maintains the right number of ManageWorkers
-//
-// It creates a groupcache group for rendering, if toggled.
-//
-// Logs from workers are prefixed with their number. This may be larger than
-// max workers as the ID increases after crashes.
+// backend returns the Renderer for a resolved version, without Middleware
+func (h *handler) backend(version string) Renderer {
+	if wp, ok := h.Versions[version]; ok {
+		return wp
+	}
+	if h.Renderer != nil {
+		return h.Renderer
+	}
+	return &h.WorkerPool
+}
+
+// resolveLayout picks the engine for a request
 //
-// Returns only when ctx is done.
-func (h *handler) ManageWorkers(ctx context.Context) {
-	if h.GroupCache {
-		h.renderGroup = h.makeRenderCache()
-	}
-	if h.workerCh == nil {
-		h.workerCh = make(chan workerReq)
-	}
-	// Start as many workers as able, new ones spinning up as old ones exit.
-	var i int
-	sem := make(chan struct{}, h.Workers)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case sem <- struct{}{}:
-			go func(i int) {
-				// TODO: Expose worker counters
-				h.worker(ctx, i)
-				// drain so we can spawn another
-				<-sem
-			}(i)
-			i++
+// Renderers that know whether Graphviz is installed fall back to Smetana
+// without it. Others are left to PlantUML's default.
+func resolveLayout(r Renderer, layout pb.Layout) (pb.Layout, error) {
+	g, ok := r.(interface{ Graphviz() bool })
+	if !ok {
+		return layout, nil
+	}
+	switch layout {
+	case pb.Layout_DEFAULT_LAYOUT:
+		if g.Graphviz() {
+			return pb.Layout_GRAPHVIZ, nil
+		}
+		return pb.Layout_SMETANA, nil
+	case pb.Layout_GRAPHVIZ:
+		if !g.Graphviz() {
+			return layout, status.Error(
+				codes.FailedPrecondition,
+				"graphviz isn't available, use the smetana layout instead",
+			)
 		}
 	}
+	return layout, nil
 }
 
-// WorkerRender is a convenience function to hide the return channel.
-func (h *handler) WorkerRender(text string, format pb.Format) ([][]byte, error) {
-	ch := make(chan workerRes)
-	h.workerCh <- workerReq{text: text, format: format, result: ch}
-	result := <-ch
-	return result.data, result.err
+// resolveVersion maps the version a request asked for to one in Versions
+//
+// Returns "" when Versions isn't used.
+func (h *handler) resolveVersion(version string) (string, error) {
+	if len(h.Versions) == 0 {
+		if version != "" {
+			return "", status.Errorf(
+				codes.InvalidArgument,
+				"server has a single plantuml version, can't pick %q", version,
+			)
+		}
+		return "", nil
+	}
+
+	if version == "" {
+		version = h.DefaultVersion
+	}
+	if version == "" {
+		names := sortedVersions(h.Versions)
+		version = names[len(names)-1]
+	}
+	if _, ok := h.Versions[version]; !ok {
+		return "", status.Errorf(
+			codes.InvalidArgument,
+			"unknown plantuml version %q, choose from: %s",
+			version, strings.Join(sortedVersions(h.Versions), ", "),
+		)
+	}
+	return version, nil
 }
 
-func (h *handler) Render(ctx context.Context, req *pb.RenderRequest) (*pb.RenderResponse, error) {
-	glog.Info("hitting render")
-	if !h.GroupCache {
+func (h *handler) Render(ctx context.Context, req *pb.RenderRequest) (resp *pb.RenderResponse, err error) {
+	defer func(format pb.Format, start time.Time) {
+		code, elapsed := status.Code(err), time.Since(start)
+		renderDuration.WithLabelValues(formatLabel(format), code.String()).Observe(elapsed.Seconds())
+		glog.V(1).Infof("render: %s", logFields(ctx,
+			"format", formatLabel(format), "code", code, "duration", elapsed.Round(time.Millisecond),
+		))
+	}(req.GetFormat(), time.Now())
+
+	ctx, span := tracer().Start(ctx, "Render", trace.WithAttributes(
+		attrFormat.String(formatLabel(req.GetFormat())),
+		attrLayout.String(strings.ToLower(req.GetLayout().String())),
+		attrRequestID.String(RequestID(ctx)),
+	))
+	defer func() { endSpan(span, err) }()
+
+	if req.GetBypassCache() && !h.AllowBypassCache {
+		return nil, status.Error(codes.PermissionDenied, "bypassing the cache is disabled on this server")
+	}
+	req, err = h.prepareRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attrVersion.String(req.Version))
+
+	if req.BypassCache || (h.Cache == nil && h.DiskCache == nil) {
 		return h.directRender(ctx, req)
 	}
 
-	enc := req.Diagram.Short
-	if enc == "" && req.Diagram.Full == "" {
-		return nil, status.Error(
-			codes.InvalidArgument,
-			"full or short diagram must be set",
-		)
+	key, err := h.cacheKey(req)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attrCacheKey.String(key))
+	if h.Cache == nil {
+		return h.diskRender(ctx, key, req)
 	}
 
-	if enc == "" {
-		e, err := ToShort(req.Diagram.Full)
+	tier := cacheTier(h.Cache)
+	glog.V(2).Infof("cache lookup: %s", logFields(ctx, "tier", tier, "key", key))
+	ctx, cacheSpan := tracer().Start(ctx, "cache.get", trace.WithAttributes(attrTier.String(tier)))
+	ctx, lookup := withCacheResult(withRenderRequest(ctx, req))
+	resp, err = h.Cache.Get(ctx, key, h.fillCache)
+	result := lookup.get(err)
+	observeCache(tier, result)
+	cacheSpan.SetAttributes(attrHit.Bool(result == cacheHit), attrResult.String(result))
+	endSpan(cacheSpan, err)
+	return resp, err
+}
+
+// prepareRequest returns a copy of req ready for cacheKey
+//
+// The version is resolved so the default shares cache entries with requests
+// that name it, and library includes are pinned so new uploads don't collide
+// with cached renders.
+func (h *handler) prepareRequest(ctx context.Context, req *pb.RenderRequest) (*pb.RenderRequest, error) {
+	version, err := h.resolveVersion(requestVersion(ctx, req))
+	if err != nil {
+		return nil, err
+	}
+	req = proto.Clone(req).(*pb.RenderRequest)
+	req.Version = version
+	if err := checkRequestFiles(req.Files); err != nil {
+		return nil, err
+	}
+
+	if h.Library != nil {
+		text, err := diagramText(req.Diagram)
 		if err != nil {
 			return nil, err
 		}
-		enc = e
+		if pinned := h.Library.Pin(text); pinned != text {
+			req.Diagram = &pb.Diagram{Full: pinned}
+		}
 	}
+	return req, nil
+}
 
-	var resp pb.RenderResponse
-	key := fmt.Sprintf("%s:%s", req.Format.String(), enc)
-	glog.Info("doing a cache lookup")
-	if err := h.renderGroup.Get(ctx, key, groupcache.ProtoSink(&resp)); err != nil {
-		return nil, err
+// diskRender checks the DiskCache before rendering, and fills it after
+//
+// Only successful renders are stored. Problems with the disk are logged and
+// otherwise treated as misses.
+func (h *handler) diskRender(ctx context.Context, key string, req *pb.RenderRequest) (*pb.RenderResponse, error) {
+	if h.DiskCache == nil {
+		return h.directRender(ctx, req)
+	}
+	_, span := tracer().Start(ctx, "cache.disk")
+	data, ok := h.DiskCache.Get(key)
+	span.SetAttributes(attrHit.Bool(ok))
+	span.End()
+	if ok {
+		var resp pb.RenderResponse
+		if err := proto.Unmarshal(data, &resp); err == nil {
+			glog.V(2).Infof("disk cache hit: %s", logFields(ctx, "key", key))
+			observeCache("disk", cacheHit)
+			return &resp, nil
+		}
+		glog.Warningf("invalid render in disk cache: %v", key)
+	}
+	observeCache("disk", cacheMiss)
+
+	resp, err := h.directRender(ctx, req)
+	if err != nil {
+		return resp, err
 	}
-	return &resp, nil
+	data, err = proto.Marshal(resp)
+	if err == nil {
+		err = h.DiskCache.Put(key, data)
+	}
+	if err != nil {
+		glog.Errorf("unable to write render to disk cache: %v", err)
+	}
+	return resp, nil
 }
 
 // Raw render without hitting the cache
 func (h *handler) directRender(ctx context.Context, req *pb.RenderRequest) (*pb.RenderResponse, error) {
-	glog.Infof("request to render")
-
 	if req.Format == pb.Format_UNSPECIFIED {
 		return nil, status.Error(codes.InvalidArgument, "must give a valid Format")
 	}
 
-	if req.Diagram.Short == "" && req.Diagram.Full == "" {
-		return nil, status.Error(
-			codes.InvalidArgument,
-			"full or short diagram must be set",
-		)
+	text, err := diagramText(req.Diagram)
+	if err != nil {
+		return nil, err
+	}
+	version, err := h.resolveVersion(req.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRequestFiles(req.Files); err != nil {
+		return nil, err
+	}
+	if h.Security != nil {
+		if err := h.Security.checkRequest(text, req.Files); err != nil {
+			return nil, err
+		}
 	}
 
-	text := req.Diagram.Full
-	if req.Diagram.Short != "" && text == "" {
-		t, err := FromShort(req.Diagram.Short)
+	// Paths on this server are swapped back out of the images
+	sent := text
+	if h.Library != nil {
+		text = h.Library.Resolve(text)
+	}
+	if len(req.Files) > 0 {
+		dir, cleanup, err := h.writeRequestFiles(req.Files)
 		if err != nil {
-			return nil, status.Error(
-				codes.InvalidArgument,
-				"unable to decode diagram: "+err.Error(),
-			)
+			return nil, status.Errorf(codes.Internal, "unable to write include files: %v", err)
 		}
-		text = t
+		defer cleanup()
+		text = rewriteIncludes(text, req.Files, dir)
+	}
+	swaps := sourceSwaps(sent, text)
+
+	base := h.backend(version)
+	layout, err := resolveLayout(base, req.Layout)
+	if err != nil {
+		return nil, err
+	}
+	text = withLayout(text, layout)
+
+	glog.V(2).Infof("rendering: %s", logFields(ctx,
+		"version", version, "layout", strings.ToLower(layout.String()), "files", len(req.Files),
+	))
+	res, err := Chain(base, h.Middleware...).Render(ctx, text, req.Format)
+	if err == nil {
+		res, err = restoreSource(res, swaps)
+	}
+	if err == nil {
+		observeRender(req.Format, res)
+	}
+	return &pb.RenderResponse{Data: res, Version: version, Layout: layout}, err
+}
+
+// diagramText returns the full text of a diagram, expanding it if needed
+func diagramText(d *pb.Diagram) (string, error) {
+	if d.GetShort() == "" && d.GetFull() == "" {
+		return "", status.Error(
+			codes.InvalidArgument,
+			"full or short diagram must be set",
+		)
 	}
-	res, err := h.WorkerRender(text, req.Format)
-	return &pb.RenderResponse{Data: res}, err
+	if d.Full != "" {
+		return d.Full, nil
+	}
+	text, err := FromShort(d.Short)
+	if err != nil {
+		return "", status.Error(
+			codes.InvalidArgument,
+			"unable to decode diagram: "+err.Error(),
+		)
+	}
+	return text, nil
 }
 
 func (h *handler) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
@@ -261,3 +496,137 @@ func (h *handler) Extract(ctx context.Context, req *pb.ExtractRequest) (*pb.Extr
 
 	return &pb.ExtractResponse{Diagram: &pb.Diagram{Full: text, Short: short}}, nil
 }
+
+func (h *handler) library() (*IncludeLibrary, error) {
+	if h.Library == nil {
+		return nil, status.Error(codes.Unimplemented, "include library isn't enabled on this server")
+	}
+	return h.Library, nil
+}
+
+func (h *handler) PutInclude(ctx context.Context, req *pb.PutIncludeRequest) (*pb.PutIncludeResponse, error) {
+	lib, err := h.library()
+	if err != nil {
+		return nil, err
+	}
+	file, err := lib.Put(req.Name, req.Content)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("stored include %s@%d (%d bytes)", file.Name, file.Version, file.Size)
+	return &pb.PutIncludeResponse{File: file}, nil
+}
+
+func (h *handler) GetInclude(ctx context.Context, req *pb.GetIncludeRequest) (*pb.GetIncludeResponse, error) {
+	lib, err := h.library()
+	if err != nil {
+		return nil, err
+	}
+	file, content, err := lib.Get(req.Name, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetIncludeResponse{File: file, Content: content}, nil
+}
+
+func (h *handler) ListIncludes(ctx context.Context, req *pb.ListIncludesRequest) (*pb.ListIncludesResponse, error) {
+	lib, err := h.library()
+	if err != nil {
+		return nil, err
+	}
+	files, err := lib.List(req.Prefix, req.AllVersions)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ListIncludesResponse{Files: files}, nil
+}
+
+func (h *handler) DeleteInclude(ctx context.Context, req *pb.DeleteIncludeRequest) (*pb.DeleteIncludeResponse, error) {
+	lib, err := h.library()
+	if err != nil {
+		return nil, err
+	}
+	if err := lib.Delete(req.Name, req.Version); err != nil {
+		return nil, err
+	}
+	glog.Infof("deleted include %s (version: %d)", req.Name, req.Version)
+	return &pb.DeleteIncludeResponse{}, nil
+}
+
+// requestKey returns the cache key Render would use for req
+func (h *handler) requestKey(ctx context.Context, req *pb.RenderRequest) (string, error) {
+	if req == nil {
+		return "", status.Error(codes.InvalidArgument, "must give a request")
+	}
+	req, err := h.prepareRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return h.cacheKey(req)
+}
+
+func (h *handler) LookupCache(ctx context.Context, req *pb.LookupCacheRequest) (*pb.LookupCacheResponse, error) {
+	key, err := h.requestKey(ctx, req.Request)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.LookupCacheResponse{Key: key}
+	if c, ok := h.Cache.(interface {
+		Contains(context.Context, string) (bool, error)
+	}); ok {
+		if resp.Cached, err = c.Contains(ctx, key); err != nil {
+			return nil, status.Errorf(codes.Unavailable, "unable to check cache: %v", err)
+		}
+	}
+	if c, ok := h.Cache.(interface{ Owner(string) string }); ok {
+		resp.Owner = c.Owner(key)
+	}
+	if h.DiskCache != nil {
+		resp.OnDisk = h.DiskCache.Contains(key)
+	}
+	return resp, nil
+}
+
+func (h *handler) PurgeCache(ctx context.Context, req *pb.PurgeCacheRequest) (*pb.PurgeCacheResponse, error) {
+	keys := append([]string{}, req.Keys...)
+	for _, r := range req.Requests {
+		key, err := h.requestKey(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		if !cacheKeyFormat.MatchString(key) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid cache key: %q", key)
+		}
+	}
+	for _, key := range keys {
+		if c, ok := h.Cache.(interface {
+			Remove(context.Context, string) error
+		}); ok {
+			if err := c.Remove(ctx, key); err != nil {
+				return nil, status.Errorf(codes.Unavailable, "unable to purge %s: %v", key, err)
+			}
+		}
+		if h.DiskCache != nil {
+			h.DiskCache.Remove(key)
+		}
+		glog.Infof("purged render from cache: %s", key)
+	}
+	return &pb.PurgeCacheResponse{Keys: keys}, nil
+}
+
+func (h *handler) GetCacheStats(ctx context.Context, req *pb.GetCacheStatsRequest) (*pb.GetCacheStatsResponse, error) {
+	resp := &pb.GetCacheStatsResponse{}
+	if c, ok := h.Cache.(interface {
+		Stats() (*pb.GroupCacheStats, []*pb.CacheStats)
+	}); ok {
+		resp.Group, resp.Caches = c.Stats()
+	}
+	if h.DiskCache != nil {
+		resp.Caches = append(resp.Caches, h.DiskCache.Stats())
+	}
+	return resp, nil
+}
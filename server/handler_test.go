@@ -2,17 +2,30 @@ package server
 
 import (
 	"context"
+	"os"
+	"os/exec"
 	"strings"
 	"testing"
 
 	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// requirePlantUML skips tests that need a real Java + PlantUML install
+func requirePlantUML(tb testing.TB) {
+	tb.Helper()
+	if _, err := exec.LookPath(DefaultHandler.JavaExe); err != nil {
+		tb.Skipf("java not found: %v", err)
+	}
+	if _, err := os.Stat(DefaultHandler.PlantUMLPath); err != nil {
+		tb.Skipf("plantuml not found: %v", err)
+	}
+}
+
 func TestPages(t *testing.T) {
-	h := DefaultHandler
+	h := fakeHandler(t)
 	ctx := context.Background()
-	go h.ManageWorkers(ctx)
-	defer ctx.Done()
 
 	table := []struct {
 		text        string
@@ -26,14 +39,14 @@ func TestPages(t *testing.T) {
 	}
 	for _, tc := range table {
 		req := pb.RenderRequest{
-			Diagram: &pb.Diagram{Source: tc.text},
+			Diagram: &pb.Diagram{Full: tc.text},
 			Format:  pb.Format_PNG,
 		}
 		res, err := h.Render(ctx, &req)
 		if err != nil && tc.expectedCnt != 0 {
 			t.Errorf("found error: %v\ndiagram: %v", err, tc.text)
 		}
-		if len(res.Data) != tc.expectedCnt {
+		if len(res.GetData()) != tc.expectedCnt {
 			t.Errorf("expected %v pages, got %v\ndiagram: %v", tc.expectedCnt, len(res.Data), tc.text)
 		}
 	}
@@ -104,10 +117,37 @@ skinparam folderBackgroundColor<<DEV JAVA>> White
 @enduml`
 
 func TestExtract(t *testing.T) {
-	h := DefaultHandler
+	h := fakeHandler(t)
 	ctx := context.Background()
+
+	for _, format := range []pb.Format{pb.Format_PNG, pb.Format_SVG} {
+		// Dashes are mangled in SVG comments, so make sure they survive.
+		for _, text := range []string{e1, "@startuml\nFoo --> Bar\n@enduml"} {
+			res, err := h.Render(ctx, &pb.RenderRequest{
+				Diagram: &pb.Diagram{Full: text},
+				Format:  format,
+			})
+			if err != nil {
+				t.Fatalf("unexpected failure in test setup: %v", err)
+			}
+			ex, err := h.Extract(ctx, &pb.ExtractRequest{Data: res.Data[0]})
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", format, err)
+			}
+			if got := ex.Diagram.Full; got != text {
+				t.Errorf("%s: diagram doesn't match expected\nExpected: %v\nGot: %v", format, text, got)
+			}
+		}
+	}
+}
+
+// Only PlantUML can expand macros, so this needs the real thing
+func TestExtractMacros(t *testing.T) {
+	requirePlantUML(t)
+	h := DefaultHandler
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go h.ManageWorkers(ctx)
-	defer ctx.Done()
 
 	table := []struct {
 		text         string
@@ -119,15 +159,18 @@ func TestExtract(t *testing.T) {
 	}
 	for _, tc := range table {
 		res, err := h.Render(ctx, &pb.RenderRequest{
-			Diagram: &pb.Diagram{Source: tc.text},
+			Diagram: &pb.Diagram{Full: tc.text},
 			Format:  pb.Format_PNG,
 		})
 		if err != nil {
-			t.Errorf("unexpected failure in test setup: %v", err)
+			t.Fatalf("unexpected failure in test setup: %v", err)
 		}
 		ex, err := h.Extract(ctx, &pb.ExtractRequest{Data: res.Data[0], ExpandMacros: tc.expandMacros})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
 
-		got := ex.Diagram.Source
+		got := ex.Diagram.Full
 		exp := tc.expected
 		if got != exp {
 			t.Errorf("diagram doesn't match expected\nExpected: %v\nGot: %v", exp, got)
@@ -208,18 +251,18 @@ end
 `
 
 func benchmarkExtract(b *testing.B, format pb.Format) {
-	h := DefaultHandler
+	h := fakeHandler(b)
 	ctx := context.Background()
-	go h.ManageWorkers(ctx)
 
 	req := pb.RenderRequest{
-		Diagram: &pb.Diagram{Source: benchSource},
-		Format:  pb.Format_PNG,
+		Diagram: &pb.Diagram{Full: benchSource},
+		Format:  format,
 	}
 	res, err := h.Render(ctx, &req)
 	if err != nil {
-		b.Errorf("unexpected error in benchmark setup: %v", err)
+		b.Fatalf("unexpected error in benchmark setup: %v", err)
 	}
+	b.ResetTimer()
 
 	for n := 0; n < b.N; n++ {
 		x, err := h.Extract(ctx, &pb.ExtractRequest{Data: res.Data[0]})
@@ -228,7 +271,7 @@ func benchmarkExtract(b *testing.B, format pb.Format) {
 		}
 
 		pre := normalizeText(benchSource)
-		post := x.Diagram.Source
+		post := x.Diagram.Full
 
 		if !strings.EqualFold(pre, post) {
 			b.Errorf("Pre and post extract don't match:\nPre: %v\nPost: %v", pre, post)
@@ -243,3 +286,153 @@ func BenchmarkPNG(b *testing.B) {
 func BenchmarkSVG(b *testing.B) {
 	benchmarkExtract(b, pb.Format_SVG)
 }
+
+// echoRenderer returns the diagram text as the only page
+var echoRenderer = RendererFunc(func(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+	return [][]byte{[]byte(format.String() + ":" + text)}, nil
+})
+
+func TestRenderWithRenderer(t *testing.T) {
+	h := handler{Renderer: echoRenderer}
+	ctx := context.Background()
+
+	short, err := ToShort("@startuml\nBob -> Alice\n@enduml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	table := []struct {
+		req      *pb.RenderRequest
+		expected string
+		code     codes.Code
+	}{
+		{
+			&pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml\nrectangle Foo\n@enduml"}, Format: pb.Format_SVG},
+			"SVG:@startuml\nrectangle Foo\n@enduml",
+			codes.OK,
+		},
+		{
+			&pb.RenderRequest{Diagram: &pb.Diagram{Short: short}, Format: pb.Format_PNG},
+			"PNG:@startuml\nBob -> Alice\n@enduml",
+			codes.OK,
+		},
+		{&pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml"}}, "", codes.InvalidArgument},
+		{&pb.RenderRequest{Diagram: &pb.Diagram{}, Format: pb.Format_PNG}, "", codes.InvalidArgument},
+	}
+	for _, tc := range table {
+		res, err := h.Render(ctx, tc.req)
+		if status.Code(err) != tc.code {
+			t.Errorf("expected code %v, got: %v", tc.code, err)
+			continue
+		}
+		if err == nil && string(res.Data[0]) != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, res.Data[0])
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tag := func(name string) Middleware {
+		return func(next Renderer) Renderer {
+			return RendererFunc(func(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+				return next.Render(ctx, text+"|"+name, format)
+			})
+		}
+	}
+	h := handler{Renderer: echoRenderer, Middleware: []Middleware{tag("outer"), tag("inner")}}
+	res, err := h.Render(context.Background(), &pb.RenderRequest{
+		Diagram: &pb.Diagram{Full: "x"},
+		Format:  pb.Format_PNG,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(res.Data[0]); got != "PNG:x|outer|inner" {
+		t.Errorf("middleware ran in the wrong order: %q", got)
+	}
+	if !h.Ready() {
+		t.Errorf("expected custom renderer without Ready() to be ready")
+	}
+}
+
+func TestWithLayout(t *testing.T) {
+	text := "@startuml\nrectangle Foo\n@enduml\n@startuml\nrectangle Bar\n@enduml"
+	exp := "@startuml\n!pragma layout smetana\nrectangle Foo\n@enduml\n@startuml\n!pragma layout smetana\nrectangle Bar\n@enduml"
+	if got := withLayout(text, pb.Layout_SMETANA); got != exp {
+		t.Errorf("expected:\n%s\ngot:\n%s", exp, got)
+	}
+	if got := withLayout(text, pb.Layout_GRAPHVIZ); got != text {
+		t.Errorf("expected graphviz to leave text alone, got:\n%s", got)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	text := "@startuml\nclass Foo\n@enduml"
+	table := []struct {
+		dot       string
+		layout    pb.Layout
+		expected  pb.Layout
+		expectErr codes.Code
+	}{
+		{"true", pb.Layout_DEFAULT_LAYOUT, pb.Layout_GRAPHVIZ, codes.OK},
+		{"true", pb.Layout_ELK, pb.Layout_ELK, codes.OK},
+		{"/nonexistent/dot", pb.Layout_DEFAULT_LAYOUT, pb.Layout_SMETANA, codes.OK},
+		{"/nonexistent/dot", pb.Layout_GRAPHVIZ, pb.Layout_GRAPHVIZ, codes.FailedPrecondition},
+	}
+	for _, tc := range table {
+		h := &handler{WorkerPool: *fakePool(t)}
+		h.GraphvizDot = tc.dot
+		runPool(t, &h.WorkerPool)
+
+		res, err := h.Render(context.Background(), &pb.RenderRequest{
+			Diagram: &pb.Diagram{Full: text},
+			Format:  pb.Format_SVG,
+			Layout:  tc.layout,
+		})
+		if status.Code(err) != tc.expectErr {
+			t.Fatalf("dot=%s layout=%s: expected %v, got: %v", tc.dot, tc.layout, tc.expectErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if res.Layout != tc.expected {
+			t.Errorf("dot=%s layout=%s: expected %s, got %s", tc.dot, tc.layout, tc.expected, res.Layout)
+		}
+
+		// The fake embeds what it was sent
+		pragma := "!pragma layout " + strings.ToLower(tc.expected.String())
+		if sent := strings.Contains(string(res.Data[0]), pragma); sent != (tc.expected != pb.Layout_GRAPHVIZ) {
+			t.Errorf("dot=%s layout=%s: unexpected pragma in diagram: %s", tc.dot, tc.layout, res.Data[0])
+		}
+	}
+}
+
+func TestRestoreSource(t *testing.T) {
+	swaps := sourceSwaps("@startuml\n!include a--b.iuml\n@enduml", "@startuml\n!include /srv/x/a--b.iuml\n@enduml")
+	if len(swaps) != 1 {
+		t.Fatalf("expected one swapped line, got %v", swaps)
+	}
+
+	// Newer PlantUML versions also keep the source encoded in SVG
+	short, _ := ToShort("@startuml\n!include /srv/x/a--b.iuml\n@enduml")
+	svg := []byte(`<svg><?plantuml-src ` + short + `?><g><!--MD5=[0]` + "\n@startuml\n!include /srv/x/a- -b.iuml\n@enduml\n\nPlantUML version 1\n--></g></svg>")
+	res, err := restoreSource([][]byte{svg}, swaps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(res[0]), "/srv/x") {
+		t.Errorf("expected paths to be removed from the comment, got %s", res[0])
+	}
+	src := svgSource.FindStringSubmatch(string(res[0]))
+	if src == nil {
+		t.Fatalf("expected plantuml-src to be kept, got %s", res[0])
+	}
+	if text, _ := FromShort(src[1]); text != "@startuml\n!include a--b.iuml\n@enduml" {
+		t.Errorf("expected plantuml-src to be restored, got %q", text)
+	}
+
+	// Other output is left alone
+	other := "SVG:\n!include /srv/x/a--b.iuml"
+	if res, err := restoreSource([][]byte{[]byte(other)}, swaps); err != nil || string(res[0]) != other {
+		t.Errorf("expected output without metadata to be unchanged, got %q: %v", res[0], err)
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HTTPHandler serves renders with PlantUML's encoded-URL scheme
+//
+// Compatible with plantuml-server clients, and lets one pmlproxy act as the
+// upstream of another's RemoteRenderer:
+//
+//	GET /png/<short>
+//	GET /svg/<short>
+//
+// Add "?version=<name>" to pick a PlantUML version, and "?layout=<engine>" to
+// pick graphviz, smetana, or elk. "?bypass_cache=true" renders fresh, if the
+// handler allows it.
+//
+// Only the first image is returned for diagrams with multiple pairs of
+// @startXYZ/@endXYZ.
+//
+// Requests are logged with the caller's RequestIDHeader, or a new one, which
+// is echoed back in the response.
+func HTTPHandler(h pb.PlantUMLServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestIDOrNew(r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+		ctx := WithRequestID(r.Context(), id)
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		format := pb.Format(pb.Format_value[strings.ToUpper(parts[0])])
+		if format == pb.Format_UNSPECIFIED {
+			http.NotFound(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		layout := pb.Layout_DEFAULT_LAYOUT
+		if l := query.Get("layout"); l != "" {
+			v, ok := pb.Layout_value[strings.ToUpper(l)]
+			if !ok {
+				http.Error(w, "unknown layout: "+l, http.StatusBadRequest)
+				return
+			}
+			layout = pb.Layout(v)
+		}
+
+		bypass, _ := strconv.ParseBool(query.Get("bypass_cache"))
+
+		resp, err := h.Render(ctx, &pb.RenderRequest{
+			Diagram:     &pb.Diagram{Short: parts[1]},
+			Format:      format,
+			Version:     query.Get("version"),
+			Layout:      layout,
+			BypassCache: bypass,
+		})
+		if err != nil {
+			glog.Warningf("http render failed: %s", logFields(ctx, "error", status.Convert(err).Message()))
+			http.Error(w, status.Convert(err).Message(), httpStatus(status.Code(err)))
+			return
+		}
+		if len(resp.Data) == 0 {
+			http.Error(w, "diagram rendered no images", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType(format))
+		w.Write(resp.Data[0])
+	})
+}
+
+func contentType(format pb.Format) string {
+	switch format {
+	case pb.Format_SVG:
+		return "image/svg+xml"
+	case pb.Format_PNG:
+		return "image/png"
+	}
+	return "application/octet-stream"
+}
+
+// httpStatus maps gRPC codes to the closest HTTP status
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Canceled:
+		return 499 // client closed request
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IncludeLibrary manages shared files that diagrams !include by name
+//
+// Files live in Dir, normally SearchPath, so PlantUML finds the latest version
+// of "ourcorp/style" at "ourcorp/style.puml" on its include path. Every
+// version is also kept under Dir/.versions/<name>/<version>.puml.
+//
+// Diagrams may refer to files with "!include <ourcorp/style>", like the
+// standard library. Pin rewrites those to the current version before caching,
+// so uploads take effect immediately and cached renders stay correct.
+//
+// Each daemon manages its own Dir. Put it on shared storage, or upload to
+// every daemon, for includes to work everywhere.
+type IncludeLibrary struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+const libraryVersionsDir = ".versions"
+
+// NewIncludeLibrary creates dir if needed
+func NewIncludeLibrary(dir string) (*IncludeLibrary, error) {
+	if err := os.MkdirAll(filepath.Join(dir, libraryVersionsDir), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create include library: %w", err)
+	}
+	return &IncludeLibrary{Dir: dir}, nil
+}
+
+var libraryName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*(/[A-Za-z0-9_-][A-Za-z0-9._-]*)*$`)
+
+func checkLibraryName(name string) error {
+	// Versions are stored as <name>/<version>.puml, which a name ending in
+	// .puml could collide with.
+	if len(name) > 200 || !libraryName.MatchString(name) || strings.HasSuffix(name, ".puml") {
+		return status.Errorf(
+			codes.InvalidArgument,
+			"invalid include name %q: use letters, numbers, '.', '_', and '-' separated by '/'",
+			name,
+		)
+	}
+	return nil
+}
+
+func (l *IncludeLibrary) latestPath(name string) string {
+	return filepath.Join(l.Dir, filepath.FromSlash(name)+".puml")
+}
+
+func (l *IncludeLibrary) versionPath(name string, version int64) string {
+	return filepath.Join(l.versionsDir(name), fmt.Sprintf("%d.puml", version))
+}
+
+func (l *IncludeLibrary) versionsDir(name string) string {
+	return filepath.Join(l.Dir, libraryVersionsDir, filepath.FromSlash(name))
+}
+
+// versions returns what's stored for name, oldest first
+func (l *IncludeLibrary) versions(name string) ([]int64, error) {
+	entries, err := os.ReadDir(l.versionsDir(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res []int64
+	for _, e := range entries {
+		v, err := strconv.ParseInt(strings.TrimSuffix(e.Name(), ".puml"), 10, 64)
+		if e.IsDir() || err != nil || !strings.HasSuffix(e.Name(), ".puml") {
+			continue
+		}
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res, nil
+}
+
+func (l *IncludeLibrary) info(name string, version int64) (*pb.IncludeFile, []byte, error) {
+	path := l.versionPath(name, version)
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil, status.Errorf(codes.NotFound, "include %s@%d not found", name, version)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(content)
+	return &pb.IncludeFile{
+		Name:        name,
+		Version:     version,
+		Size:        int64(len(content)),
+		Sha256:      hex.EncodeToString(sum[:]),
+		CreatedUnix: st.ModTime().Unix(),
+	}, content, nil
+}
+
+// Put stores content as the latest version of name
+//
+// Nothing changes if it matches the current latest.
+func (l *IncludeLibrary) Put(name string, content []byte) (*pb.IncludeFile, error) {
+	if err := checkLibraryName(name); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	versions, err := l.versions(name)
+	if err != nil {
+		return nil, err
+	}
+	var next int64 = 1
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1]
+		file, existing, err := l.info(name, latest)
+		if err != nil {
+			return nil, err
+		}
+		if string(existing) == string(content) {
+			return file, nil
+		}
+		next = latest + 1
+	}
+
+	if err := writeFileAtomic(l.versionPath(name, next), content); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(l.latestPath(name), content); err != nil {
+		return nil, err
+	}
+	file, _, err := l.info(name, next)
+	return file, err
+}
+
+// Get returns a version of name, or the latest if version is 0
+func (l *IncludeLibrary) Get(name string, version int64) (*pb.IncludeFile, []byte, error) {
+	if err := checkLibraryName(name); err != nil {
+		return nil, nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if version == 0 {
+		versions, err := l.versions(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(versions) == 0 {
+			return nil, nil, status.Errorf(codes.NotFound, "include %s not found", name)
+		}
+		version = versions[len(versions)-1]
+	}
+	return l.info(name, version)
+}
+
+// List returns the latest version of every name starting with prefix
+func (l *IncludeLibrary) List(prefix string, allVersions bool) ([]*pb.IncludeFile, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	root := filepath.Join(l.Dir, libraryVersionsDir)
+	var names []string
+	seen := map[string]bool{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".puml") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	var res []*pb.IncludeFile
+	for _, name := range names {
+		versions, err := l.versions(name)
+		if err != nil {
+			return nil, err
+		}
+		if !allVersions && len(versions) > 0 {
+			versions = versions[len(versions)-1:]
+		}
+		for _, v := range versions {
+			file, _, err := l.info(name, v)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, file)
+		}
+	}
+	return res, nil
+}
+
+// Delete removes a version of name, or every version if version is 0
+//
+// When the latest is removed, the one before it takes its place.
+func (l *IncludeLibrary) Delete(name string, version int64) error {
+	if err := checkLibraryName(name); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	versions, err := l.versions(name)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return status.Errorf(codes.NotFound, "include %s not found", name)
+	}
+
+	if version == 0 {
+		// Not RemoveAll, since names nested under this one share the directory
+		for _, v := range versions {
+			if err := removeIfExists(l.versionPath(name, v)); err != nil {
+				return err
+			}
+		}
+		os.Remove(l.versionsDir(name))
+		return removeIfExists(l.latestPath(name))
+	}
+
+	if err := os.Remove(l.versionPath(name, version)); os.IsNotExist(err) {
+		return status.Errorf(codes.NotFound, "include %s@%d not found", name, version)
+	} else if err != nil {
+		return err
+	}
+	latest := versions[len(versions)-1]
+	if version != latest {
+		return nil
+	}
+	if len(versions) == 1 {
+		os.Remove(l.versionsDir(name))
+		return removeIfExists(l.latestPath(name))
+	}
+	_, content, err := l.info(name, versions[len(versions)-2])
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(l.latestPath(name), content)
+}
+
+var libraryInclude = regexp.MustCompile(`^(\s*!include\w*\s+)<([^>@]+)(?:@(\d+))?>(.*)$`)
+
+// Pin rewrites "!include <name>" to "!include <name@latest>" for library files
+//
+// Names that aren't in the library, like the standard library, are left
+// alone.
+func (l *IncludeLibrary) Pin(text string) string {
+	return l.rewrite(text, func(name string, version int64) string {
+		if version != 0 {
+			return ""
+		}
+		versions, err := l.versions(name)
+		if err != nil || len(versions) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("<%s@%d>", name, versions[len(versions)-1])
+	})
+}
+
+// Resolve rewrites "!include <name@version>" to the file's path for PlantUML
+//
+// Images get the original lines back, see sourceSwaps.
+func (l *IncludeLibrary) Resolve(text string) string {
+	return l.rewrite(text, func(name string, version int64) string {
+		if version == 0 {
+			return ""
+		}
+		path, err := filepath.Abs(l.versionPath(name, version))
+		if err != nil {
+			return ""
+		}
+		if _, err := os.Stat(path); err != nil {
+			return ""
+		}
+		return path
+	})
+}
+
+// rewrite replaces library include targets with fn's result, unless it's ""
+func (l *IncludeLibrary) rewrite(text string, fn func(name string, version int64) string) string {
+	if !strings.Contains(text, "<") {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		m := libraryInclude.FindStringSubmatch(line)
+		if m == nil || checkLibraryName(m[2]) != nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(m[3], 10, 64)
+		if target := fn(m[2], version); target != "" {
+			lines[i] = m[1] + target + m[4]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeFileAtomic replaces path so PlantUML never reads a partial file
+func writeFileAtomic(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
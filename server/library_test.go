@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIncludeLibrary(t *testing.T) {
+	lib, err := NewIncludeLibrary(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, content := range []string{"!$color = red", "!$color = red", "!$color = blue"} {
+		if _, err := lib.Put("ourcorp/style", []byte(content)); err != nil {
+			t.Fatalf("put %d: unexpected error: %v", i, err)
+		}
+	}
+	if _, err := lib.Put("ourcorp/style/dark", []byte("!$color = black")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Identical uploads don't make a new version
+	files, err := lib.List("ourcorp/", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, fmt.Sprintf("%s@%d", f.Name, f.Version))
+	}
+	if exp := "ourcorp/style@1 ourcorp/style@2 ourcorp/style/dark@1"; strings.Join(got, " ") != exp {
+		t.Errorf("expected %s, got %s", exp, strings.Join(got, " "))
+	}
+
+	latest, err := os.ReadFile(filepath.Join(lib.Dir, "ourcorp/style.puml"))
+	if err != nil || string(latest) != "!$color = blue" {
+		t.Errorf("expected latest on the include path, got %q: %v", latest, err)
+	}
+
+	// Removing the latest puts the previous one back
+	if err := lib.Delete("ourcorp/style", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	file, content, err := lib.Get("ourcorp/style", 0)
+	if err != nil || file.Version != 1 || string(content) != "!$color = red" {
+		t.Errorf("expected version 1 after deleting 2, got %v %q: %v", file, content, err)
+	}
+	latest, _ = os.ReadFile(filepath.Join(lib.Dir, "ourcorp/style.puml"))
+	if string(latest) != "!$color = red" {
+		t.Errorf("expected include path to have version 1, got %q", latest)
+	}
+
+	// Deleting every version leaves nested names alone
+	if err := lib.Delete("ourcorp/style", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := lib.Get("ourcorp/style", 0); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got: %v", err)
+	}
+	if _, _, err := lib.Get("ourcorp/style/dark", 0); err != nil {
+		t.Errorf("expected nested name to survive, got: %v", err)
+	}
+
+	for _, name := range []string{"", "../etc/passwd", "/abs", ".versions/x", "a//b", "style.puml"} {
+		if _, err := lib.Put(name, nil); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%q: expected InvalidArgument, got: %v", name, err)
+		}
+	}
+}
+
+func TestIncludeLibraryRender(t *testing.T) {
+	lib, err := NewIncludeLibrary(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lib.Put("ourcorp/style", []byte("v1"))
+	lib.Put("ourcorp/style", []byte("v2"))
+
+	h := &handler{Renderer: echoRenderer, Library: lib}
+	render := func(text string) string {
+		res, err := h.Render(context.Background(), &pb.RenderRequest{
+			Diagram: &pb.Diagram{Full: text},
+			Format:  pb.Format_SVG,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return string(res.Data[0])
+	}
+
+	path := func(v string) string {
+		p, _ := filepath.Abs(filepath.Join(lib.Dir, ".versions/ourcorp/style", v+".puml"))
+		return p
+	}
+	table := []struct {
+		include  string
+		expected string
+	}{
+		{"!include <ourcorp/style>", "!include " + path("2")},
+		{"!include_once <ourcorp/style@1>", "!include_once " + path("1")},
+		{"!include <C4/C4_Container>", "!include <C4/C4_Container>"},
+	}
+	for _, tc := range table {
+		got := render("@startuml\n" + tc.include + "\n@enduml")
+		if !strings.Contains(got, tc.expected+"\n") {
+			t.Errorf("%s: expected %q, got:\n%s", tc.include, tc.expected, got)
+		}
+	}
+}
+
+func TestIncludeLibraryExtract(t *testing.T) {
+	lib, err := NewIncludeLibrary(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lib.Put("ourcorp/style", []byte("skinparam monochrome true"))
+	h := fakeHandler(t)
+	h.Library = lib
+
+	// Pinned, but without paths from this server
+	want := "@startuml\n!include <ourcorp/style@1>\nrectangle Foo\n@enduml"
+	for _, format := range []pb.Format{pb.Format_PNG, pb.Format_SVG} {
+		res, err := h.Render(context.Background(), &pb.RenderRequest{
+			Diagram: &pb.Diagram{Full: "@startuml\n!include <ourcorp/style>\nrectangle Foo\n@enduml"},
+			Format:  format,
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		ex, err := h.Extract(context.Background(), &pb.ExtractRequest{Data: res.Data[0]})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if got := ex.Diagram.Full; got != want {
+			t.Errorf("%s: expected %q, got %q", format, want, got)
+		}
+	}
+}
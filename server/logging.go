@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Logs are plain glog lines with "key=value" pairs after the message, led by
+// the request ID when there is one:
+//
+//	render: req=5f2c9a1e7b3d4c60 format=svg code=OK duration=84ms
+//	[2 req=5f2c9a1e7b3d4c60] rendering: pages=1 format=svg diagram=sha256:8d1e0b3a9f4c bytes=57
+//
+// Verbosity is glog's -v:
+//
+//	0  lifecycle, warnings, and errors
+//	1  a line per request
+//	2  cache lookups and worker steps for each request
+//
+// Diagram text is replaced by a digest unless WorkerPool.LogDiagrams is set.
+
+// RequestIDHeader carries a request's ID in gRPC metadata and HTTP headers
+//
+// Callers can set it to find their request in our logs, otherwise we make one
+// up. Either way, it's sent back in the response headers and passed on to
+// groupcache peers and upstreams.
+const RequestIDHeader = "X-Request-Id"
+
+// IDs from callers longer than this, or with characters outside
+// [A-Za-z0-9._-], are replaced so they can't forge log lines.
+const maxRequestIDLen = 64
+
+type requestIDKey struct{}
+
+// WithRequestID labels log lines for ctx with id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID set by WithRequestID, or "" if there isn't one
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDOrNew returns id if it's safe to log, otherwise a random one
+func requestIDOrNew(id string) string {
+	if id != "" && len(id) <= maxRequestIDLen && strings.Trim(id, requestIDChars) == "" {
+		return id
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+const requestIDChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789._-"
+
+// RequestIDInterceptor gives each gRPC call a request ID
+//
+// Taken from the caller's RequestIDHeader metadata when valid, and returned
+// in the response headers.
+func RequestIDInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(RequestIDHeader); len(v) > 0 {
+			id = v[0]
+		}
+	}
+	id = requestIDOrNew(id)
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+	return handler(WithRequestID(ctx, id), req)
+}
+
+// logFields formats key/value pairs for a log line, after ctx's request ID
+//
+// Values with spaces, quotes, or '=' are quoted.
+func logFields(ctx context.Context, kv ...interface{}) string {
+	var b strings.Builder
+	if id := RequestID(ctx); id != "" {
+		b.WriteString("req=")
+		b.WriteString(id)
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		v := fmt.Sprint(kv[i+1])
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, "%v=%s", kv[i], v)
+	}
+	return b.String()
+}
+
+// workerTag prefixes a worker's log lines, with the request it's rendering
+func workerTag(id int, reqID string) string {
+	if reqID == "" {
+		return fmt.Sprintf("[%d]", id)
+	}
+	return fmt.Sprintf("[%d req=%s]", id, reqID)
+}
+
+// diagramFields describe a diagram for logFields without its content
+//
+// Diagrams can hold anything users draw, so only a digest is logged unless
+// full is set, in which case it's the short code.
+func diagramFields(text string, full bool) []interface{} {
+	if full {
+		short, _ := ToShort(text)
+		return []interface{}{"diagram", short, "bytes", len(text)}
+	}
+	sum := sha256.Sum256([]byte(text))
+	return []interface{}{"diagram", "sha256:" + hex.EncodeToString(sum[:6]), "bytes", len(text)}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIDInterceptor(t *testing.T) {
+	for name, tc := range map[string]struct {
+		sent string
+		keep bool
+	}{
+		"from caller": {"build-42.a_b", true},
+		"missing":     {"", false},
+		"forged line": {"x\nE1018 forged", false},
+		"too long":    {strings.Repeat("a", maxRequestIDLen+1), false},
+	} {
+		ctx := context.Background()
+		if tc.sent != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(RequestIDHeader, tc.sent))
+		}
+		var got string
+		RequestIDInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			got = RequestID(ctx)
+			return nil, nil
+		})
+		if tc.keep && got != tc.sent {
+			t.Errorf("%s: expected request ID %q, got %q", name, tc.sent, got)
+		}
+		if !tc.keep && len(got) != 16 {
+			t.Errorf("%s: expected a generated request ID, got %q", name, got)
+		}
+	}
+}
+
+func TestHTTPRequestID(t *testing.T) {
+	var got string
+	h := &handler{Renderer: RendererFunc(func(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+		got = RequestID(ctx)
+		return [][]byte{[]byte(text)}, nil
+	})}
+	srv := httptest.NewServer(HTTPHandler(h))
+	defer srv.Close()
+
+	short, _ := ToShort("@startuml\nrectangle Logged\n@enduml")
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/svg/"+short, nil)
+	req.Header.Set(RequestIDHeader, "abc123")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if got != "abc123" {
+		t.Errorf("expected renderer to see request ID abc123, got %q", got)
+	}
+	if echoed := resp.Header.Get(RequestIDHeader); echoed != "abc123" {
+		t.Errorf("expected request ID echoed in response, got %q", echoed)
+	}
+}
+
+func TestPeerRequestID(t *testing.T) {
+	opts := CachePoolOptions()
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestID(opts.Context(r))
+	}))
+	defer srv.Close()
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	httpReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := opts.Transport(ctx).RoundTrip(httpReq)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if got != "abc123" {
+		t.Errorf("expected peer to log with request ID abc123, got %q", got)
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "abc123")
+	got := logFields(ctx, "format", "svg", "error", `bad "thing"`, "version", "")
+	want := `req=abc123 format=svg error="bad \"thing\"" version=""`
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if got := logFields(context.Background(), "pages", 2); got != "pages=2" {
+		t.Errorf("expected no request ID without one, got %s", got)
+	}
+}
+
+func TestDiagramFieldsRedact(t *testing.T) {
+	text := "@startuml\nrectangle \"Secret Project\"\n@enduml"
+	short, _ := ToShort(text)
+
+	redacted := logFields(context.Background(), diagramFields(text, false)...)
+	if strings.Contains(redacted, short) || strings.Contains(redacted, "Secret") {
+		t.Errorf("expected diagram to be redacted, got %s", redacted)
+	}
+	if !strings.Contains(redacted, "diagram=sha256:") {
+		t.Errorf("expected a digest of the diagram, got %s", redacted)
+	}
+	if full := logFields(context.Background(), diagramFields(text, true)...); !strings.Contains(full, short) {
+		t.Errorf("expected the short code with LogDiagrams, got %s", full)
+	}
+}
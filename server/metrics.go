@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	renderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "PlantUML",
+		Name:      "render_seconds",
+		Help:      "duration of render requests, including cache hits, by format and grpc status code",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"format", "code"})
+	renderPages = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "PlantUML",
+		Name:      "render_pages",
+		Help:      "pages in each diagram rendered by a backend",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+	}, []string{"format"})
+	renderBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "PlantUML",
+		Name:      "render_bytes",
+		Help:      "size of every page in each diagram rendered by a backend",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"format"})
+	queueWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "PlantUML",
+		Name:      "queue_wait_seconds",
+		Help:      "time requests waited for a free worker",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	})
+
+	workerStarts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "PlantUML",
+		Name:      "worker_starts_total",
+		Help:      "plantuml processes started",
+	})
+	workerCrashes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "PlantUML",
+		Name:      "worker_crashes_total",
+		Help:      "plantuml processes that exited after failing to warm up or render",
+	})
+	workerTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "PlantUML",
+		Name:      "worker_timeouts_total",
+		Help:      "plantuml processes killed for taking longer than the render timeout",
+	})
+	workerStates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "PlantUML",
+		Name:      "workers",
+		Help:      "plantuml processes by state: warming, idle, or busy",
+	}, []string{"state"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "PlantUML",
+		Name:      "cache_requests_total",
+		Help:      "render cache lookups by tier (group, lru, or disk) and result (hit, miss, peer, or error)",
+	}, []string{"tier", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(renderDuration)
+	prometheus.MustRegister(renderPages)
+	prometheus.MustRegister(renderBytes)
+	prometheus.MustRegister(queueWait)
+	prometheus.MustRegister(workerStarts)
+	prometheus.MustRegister(workerCrashes)
+	prometheus.MustRegister(workerTimeouts)
+	prometheus.MustRegister(workerStates)
+	prometheus.MustRegister(cacheRequests)
+}
+
+// formatLabel is how formats appear in metrics, eg. "svg"
+func formatLabel(f pb.Format) string {
+	return strings.ToLower(f.String())
+}
+
+// observeRender records the pages and size of a backend's render
+func observeRender(format pb.Format, data [][]byte) {
+	var size int
+	for _, page := range data {
+		size += len(page)
+	}
+	renderPages.WithLabelValues(formatLabel(format)).Observe(float64(len(data)))
+	renderBytes.WithLabelValues(formatLabel(format)).Observe(float64(size))
+}
+
+// cacheTier names a RenderCache in metrics
+func cacheTier(c RenderCache) string {
+	switch c.(type) {
+	case *GroupCache:
+		return "group"
+	case *LRUCache:
+		return "lru"
+	case NoCache:
+		return "none"
+	}
+	return "custom"
+}
+
+// Results of a cache lookup
+const (
+	cacheHit   = "hit"   // already cached here
+	cacheMiss  = "miss"  // rendered here, whether or not that worked
+	cachePeer  = "peer"  // fetched from the groupcache peer that owns the key
+	cacheError = "error" // failed before finding or rendering anything
+)
+
+func observeCache(tier, result string) {
+	cacheRequests.WithLabelValues(tier, result).Inc()
+}
+
+type cacheResultKey struct{}
+
+// cacheResult is how a RenderCache answered, see withCacheResult
+type cacheResult struct {
+	mu     sync.Mutex
+	result string
+}
+
+// withCacheResult tracks how a RenderCache answers the request in ctx
+//
+// Caches call fills with their own arguments, and groupcache only knows the
+// one it was registered with, so fillCache and peerTransport report through
+// ctx. Lookups are hits unless they say otherwise.
+func withCacheResult(ctx context.Context) (context.Context, *cacheResult) {
+	r := &cacheResult{result: cacheHit}
+	return context.WithValue(ctx, cacheResultKey{}, r), r
+}
+
+func setCacheResult(ctx context.Context, result string) {
+	if r, ok := ctx.Value(cacheResultKey{}).(*cacheResult); ok {
+		r.mu.Lock()
+		r.result = result
+		r.mu.Unlock()
+	}
+}
+
+// get returns the result of a lookup that returned err
+func (r *cacheResult) get(err error) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil && r.result == cacheHit {
+		return cacheError
+	}
+	return r.result
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// observations returns how many values a histogram has seen
+func observations(t *testing.T, o prometheus.Observer) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := o.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("unable to read metric: %v", err)
+	}
+	return m.Histogram.GetSampleCount()
+}
+
+func TestRenderMetrics(t *testing.T) {
+	disk, err := NewDiskCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := &handler{Cache: NewLRUCache(1<<20, 0), DiskCache: disk, Renderer: echoRenderer}
+	req := &pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml\nrectangle Metrics\n@enduml"}, Format: pb.Format_SVG}
+
+	ok := renderDuration.WithLabelValues("svg", "OK")
+	invalid := renderDuration.WithLabelValues("unspecified", "InvalidArgument")
+	pages := renderPages.WithLabelValues("svg")
+	before := map[string]float64{}
+	counters := map[string]prometheus.Counter{
+		"lru hit":   cacheRequests.WithLabelValues("lru", "hit"),
+		"lru miss":  cacheRequests.WithLabelValues("lru", "miss"),
+		"disk miss": cacheRequests.WithLabelValues("disk", "miss"),
+	}
+	for name, c := range counters {
+		before[name] = testutil.ToFloat64(c)
+	}
+	okBefore, invalidBefore, pagesBefore := observations(t, ok), observations(t, invalid), observations(t, pages)
+
+	h.Render(context.Background(), req)
+	h.Render(context.Background(), req)
+	h.Render(context.Background(), &pb.RenderRequest{Diagram: req.Diagram})
+
+	// Failed renders are misses too
+	for name, want := range map[string]float64{"lru hit": 1, "lru miss": 2, "disk miss": 2} {
+		if got := testutil.ToFloat64(counters[name]) - before[name]; got != want {
+			t.Errorf("expected %v more %s, got %v", want, name, got)
+		}
+	}
+	if got := observations(t, ok) - okBefore; got != 2 {
+		t.Errorf("expected 2 successful renders observed, got %d", got)
+	}
+	if got := observations(t, invalid) - invalidBefore; got != 1 {
+		t.Errorf("expected 1 invalid render observed, got %d", got)
+	}
+	// Cache hits don't render
+	if got := observations(t, pages) - pagesBefore; got != 1 {
+		t.Errorf("expected 1 render's pages observed, got %d", got)
+	}
+}
+
+func TestCacheResult(t *testing.T) {
+	ctx, lookup := withCacheResult(context.Background())
+	if got := lookup.get(errors.New("peer down")); got != cacheError {
+		t.Errorf("expected a failed lookup without a fill to be an error, got %s", got)
+	}
+	setCacheResult(ctx, cacheMiss)
+	if got := lookup.get(errors.New("render failed")); got != cacheMiss {
+		t.Errorf("expected a failed fill to be a miss, got %s", got)
+	}
+
+	// Peer fetches are counted by the caller as such
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ctx, lookup = withCacheResult(context.Background())
+	httpReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := CachePoolOptions().Transport(ctx).RoundTrip(httpReq)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if got := lookup.get(nil); got != cachePeer {
+		t.Errorf("expected a peer result, got %s", got)
+	}
+}
+
+func TestCacheMetricsOnOwner(t *testing.T) {
+	hit := cacheRequests.WithLabelValues("group", "hit")
+	miss := cacheRequests.WithLabelValues("group", "miss")
+	failed := cacheRequests.WithLabelValues("group", "error")
+	hitBefore, missBefore, failedBefore := testutil.ToFloat64(hit), testutil.ToFloat64(miss), testutil.ToFloat64(failed)
+
+	// Stands in for groupcache, filling diagrams named "miss"
+	pool := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/miss":
+			setCacheResult(r.Context(), cacheMiss)
+		case "/broken":
+			http.Error(w, "no such group", http.StatusNotFound)
+		}
+	})
+	srv := httptest.NewServer(cachePeerHandler(pool, nil))
+	defer srv.Close()
+	for _, path := range []string{"/hit", "/miss", "/miss", "/broken"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	lookup, _ := http.NewRequest(http.MethodGet, srv.URL+"/hit", nil)
+	lookup.Header.Set(PeerLookupHeader, "1")
+	resp, err := http.DefaultClient.Do(lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	// Lookups from "pml cache" aren't renders, so they aren't counted
+	for name, tc := range map[string]struct {
+		c      prometheus.Counter
+		before float64
+		want   float64
+	}{
+		"hits":   {hit, hitBefore, 1},
+		"misses": {miss, missBefore, 2},
+		"errors": {failed, failedBefore, 1},
+	} {
+		if got := testutil.ToFloat64(tc.c) - tc.before; got != tc.want {
+			t.Errorf("expected %v more group %s, got %v", tc.want, name, got)
+		}
+	}
+}
+
+func TestWorkerMetrics(t *testing.T) {
+	starts, timeouts := testutil.ToFloat64(workerStarts), testutil.ToFloat64(workerTimeouts)
+	crashes := testutil.ToFloat64(workerCrashes)
+	idle := workerStates.WithLabelValues("idle")
+
+	wp := fakePool(t)
+	wp.WarmupDiagrams = nil
+	wp.RenderTimeout = time.Millisecond * 200
+	runPool(t, wp)
+	if testutil.ToFloat64(workerStarts)-starts < 1 {
+		t.Errorf("expected a worker start to be counted")
+	}
+	if testutil.ToFloat64(idle) < 1 {
+		t.Errorf("expected an idle worker")
+	}
+
+	ctx := context.Background()
+	wp.Render(ctx, "@startuml\n' fake: sleep 10s\n@enduml", pb.Format_PNG)
+	if got := testutil.ToFloat64(workerTimeouts) - timeouts; got != 1 {
+		t.Errorf("expected 1 timeout, got %v", got)
+	}
+	wp.Render(ctx, "@startuml\n' fake: crash\n@enduml", pb.Format_PNG)
+	if got := testutil.ToFloat64(workerCrashes) - crashes; got != 1 {
+		t.Errorf("expected 1 crash, got %v", got)
+	}
+}
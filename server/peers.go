@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cachePeers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "PlantUML",
+		Name:      "cache_peers",
+		Help:      "number of groupcache peers, including this server",
+	})
+	cachePeerInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "PlantUML",
+		Name:      "cache_peer_info",
+		Help:      "current groupcache peers, 1 for each member",
+	}, []string{"peer"})
+)
+
+func init() {
+	prometheus.MustRegister(cachePeers)
+	prometheus.MustRegister(cachePeerInfo)
+}
+
+// PeerSource finds groupcache peers, as base URLs like http://host:port
+type PeerSource interface {
+	Peers(ctx context.Context) ([]string, error)
+}
+
+// StaticPeers are always members
+type StaticPeers []string
+
+func (p StaticPeers) Peers(ctx context.Context) ([]string, error) {
+	return p, nil
+}
+
+// DNSPeers looks up peers from a headless service, or similar
+//
+// Names starting with "_" are SRV records, eg. "_cache._tcp.pmlproxy.svc",
+// which carry their own ports. Others are "host:port", where every A/AAAA
+// record of host is a peer on port.
+type DNSPeers struct {
+	Name     string
+	Resolver *net.Resolver // default: net.DefaultResolver
+}
+
+func (p DNSPeers) Peers(ctx context.Context) ([]string, error) {
+	r := p.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	if strings.HasPrefix(p.Name, "_") {
+		_, records, err := r.LookupSRV(ctx, "", "", p.Name)
+		if err != nil {
+			return nil, err
+		}
+		var res []string
+		for _, srv := range records {
+			host := strings.TrimSuffix(srv.Target, ".")
+			res = append(res, "http://"+net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+		}
+		return res, nil
+	}
+
+	host, port, err := net.SplitHostPort(p.Name)
+	if err != nil {
+		return nil, fmt.Errorf("peer dns name must be host:port or an SRV name: %w", err)
+	}
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, addr := range addrs {
+		res = append(res, "http://"+net.JoinHostPort(addr, port))
+	}
+	return res, nil
+}
+
+// FilePeers reads peers from a file, one per line, re-read on every refresh
+//
+// Lines are host:port or URLs. Blank lines and "#" comments are ignored.
+type FilePeers struct {
+	Path string
+}
+
+func (p FilePeers) Peers(ctx context.Context) ([]string, error) {
+	f, err := os.Open(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var res []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			res = append(res, line)
+		}
+	}
+	return res, scanner.Err()
+}
+
+// PeerWatcher keeps groupcache peers in sync with where they're discovered
+//
+// Peers from every source are combined, along with Self. If a source fails,
+// its previous peers are kept until the next refresh rather than dropping
+// members over a DNS blip. The other sources are still used, so static peers
+// are set even if discovery fails at start-up.
+type PeerWatcher struct {
+	// This server, as peers see it, eg. http://10.0.0.5:9001
+	Self     string
+	Sources  []PeerSource
+	Interval time.Duration
+
+	// Called with every peer, including Self, when they change. Normally the
+	// groupcache pool's Set.
+	Set func(peers ...string)
+
+	mu    sync.Mutex
+	peers []string
+	// Last successful lookup of each source, by index
+	found map[int][]string
+}
+
+// Run refreshes peers now, then every Interval until ctx is done
+func (w *PeerWatcher) Run(ctx context.Context) {
+	w.Refresh(ctx)
+	if w.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Refresh(ctx)
+		}
+	}
+}
+
+// Peers returns the current members, sorted
+func (w *PeerWatcher) Peers() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.peers...)
+}
+
+// Refresh looks up peers and calls Set if they've changed
+//
+// Returns the first source's error, after setting peers from the rest.
+func (w *PeerWatcher) Refresh(ctx context.Context) error {
+	var firstErr error
+	results := make(map[int][]string, len(w.Sources))
+	for i, src := range w.Sources {
+		peers, err := src.Peers(ctx)
+		if err != nil {
+			glog.Warningf("unable to discover cache peers, keeping the ones found before: %v", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		results[i] = peers
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.found == nil {
+		w.found = map[int][]string{}
+	}
+	for i, peers := range results {
+		w.found[i] = peers
+	}
+	found := map[string]bool{normalizePeer(w.Self): true}
+	for _, peers := range w.found {
+		for _, p := range peers {
+			found[normalizePeer(p)] = true
+		}
+	}
+	peers := make([]string, 0, len(found))
+	for p := range found {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+
+	if w.peers != nil && strings.Join(peers, " ") == strings.Join(w.peers, " ") {
+		return firstErr
+	}
+	glog.Infof("cache peers changed: %v", peers)
+	for _, p := range w.peers {
+		cachePeerInfo.DeleteLabelValues(p)
+	}
+	for _, p := range peers {
+		cachePeerInfo.WithLabelValues(p).Set(1)
+	}
+	cachePeers.Set(float64(len(peers)))
+	w.peers = peers
+	if w.Set != nil {
+		w.Set(peers...)
+	}
+	return firstErr
+}
+
+// normalizePeer gives host:port a scheme, so each peer is only listed once
+func normalizePeer(p string) string {
+	p = strings.TrimSuffix(p, "/")
+	if !strings.Contains(p, "://") {
+		p = "http://" + p
+	}
+	return p
+}
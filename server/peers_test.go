@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type fakePeers struct {
+	peers []string
+	err   error
+}
+
+func (p *fakePeers) Peers(ctx context.Context) ([]string, error) {
+	return p.peers, p.err
+}
+
+func TestPeerWatcher(t *testing.T) {
+	ctx := context.Background()
+	src := &fakePeers{peers: []string{"10.0.0.2:9001", "http://10.0.0.3:9001/"}}
+	var sets [][]string
+	w := &PeerWatcher{
+		Self:    "http://10.0.0.1:9001",
+		Sources: []PeerSource{StaticPeers{"10.0.0.1:9001"}, src},
+		Set:     func(peers ...string) { sets = append(sets, peers) },
+	}
+
+	w.Refresh(ctx)
+	want := []string{"http://10.0.0.1:9001", "http://10.0.0.2:9001", "http://10.0.0.3:9001"}
+	if !reflect.DeepEqual(w.Peers(), want) {
+		t.Errorf("expected %v, got %v", want, w.Peers())
+	}
+
+	// Unchanged peers aren't set again
+	w.Refresh(ctx)
+	if len(sets) != 1 {
+		t.Errorf("expected 1 call to Set, got %d", len(sets))
+	}
+
+	// Failed lookups keep the current peers
+	src.err = fmt.Errorf("dns timeout")
+	if err := w.Refresh(ctx); err == nil {
+		t.Errorf("expected an error")
+	}
+	if !reflect.DeepEqual(w.Peers(), want) || len(sets) != 1 {
+		t.Errorf("expected peers to be kept on error, got %v", w.Peers())
+	}
+
+	src.err = nil
+	src.peers = []string{"10.0.0.2:9001"}
+	w.Refresh(ctx)
+	want = []string{"http://10.0.0.1:9001", "http://10.0.0.2:9001"}
+	if len(sets) != 2 || !reflect.DeepEqual(sets[1], want) {
+		t.Errorf("expected Set with %v, got %v", want, sets)
+	}
+}
+
+func TestPeerWatcherFailsAtStart(t *testing.T) {
+	var sets [][]string
+	w := &PeerWatcher{
+		Self:    "http://10.0.0.1:9001",
+		Sources: []PeerSource{&fakePeers{err: fmt.Errorf("no such host")}, StaticPeers{"10.0.0.2:9001"}},
+		Set:     func(peers ...string) { sets = append(sets, peers) },
+	}
+	if err := w.Refresh(context.Background()); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	// Static peers are still set
+	want := []string{"http://10.0.0.1:9001", "http://10.0.0.2:9001"}
+	if len(sets) != 1 || !reflect.DeepEqual(sets[0], want) {
+		t.Errorf("expected Set with %v, got %v", want, sets)
+	}
+}
+
+func TestFilePeers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	os.WriteFile(path, []byte("# cache peers\n10.0.0.2:9001\n\n  http://10.0.0.3:9001 # rack b\n"), 0644)
+	got, err := FilePeers{Path: path}.Peers(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"10.0.0.2:9001", "http://10.0.0.3:9001"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, err := (FilePeers{Path: path + ".missing"}).Peers(context.Background()); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestDNSPeers(t *testing.T) {
+	got, err := DNSPeers{Name: "127.0.0.1:9001"}.Peers(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"http://127.0.0.1:9001"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, err := (DNSPeers{Name: "no-port"}).Peers(context.Background()); err == nil {
+		t.Errorf("expected an error without a port")
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Large enough that most SVGs are read in a handful of syscalls
+const pipeBufSize = 64 * 1024
+
+// Buffers over this size aren't returned to the pool so that one huge render
+// doesn't pin memory forever.
+const maxPooledPage = 16 * 1024 * 1024
+
+var pagePool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// pipeReader splits PlantUML's stdout into images on the pipe delimiter
+//
+// Reads in large chunks and only scans what's new since the last read, plus
+// enough of the tail to catch a delimiter split across reads. Bytes after a
+// delimiter are left buffered for the next image.
+type pipeReader struct {
+	r     *bufio.Reader
+	delim []byte
+}
+
+func newPipeReader(r io.Reader, delim []byte) *pipeReader {
+	return &pipeReader{
+		r:     bufio.NewReaderSize(r, pipeBufSize),
+		delim: delim,
+	}
+}
+
+// next returns everything up to the next delimiter, blocking until it's seen
+func (p *pipeReader) next() ([]byte, error) {
+	buf := pagePool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledPage {
+			pagePool.Put(buf)
+		}
+	}()
+
+	for {
+		// Blocks until at least one byte is available
+		if _, err := p.r.Peek(1); err != nil {
+			if err == io.EOF && buf.Len() > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		data, _ := p.r.Peek(p.r.Buffered())
+
+		// The delimiter may have started in a previous chunk
+		searchFrom := buf.Len() - len(p.delim) + 1
+		if searchFrom < 0 {
+			searchFrom = 0
+		}
+		prevLen := buf.Len()
+		buf.Write(data)
+
+		if i := bytes.Index(buf.Bytes()[searchFrom:], p.delim); i != -1 {
+			end := searchFrom + i
+			p.r.Discard(end + len(p.delim) - prevLen)
+			page := make([]byte, end)
+			copy(page, buf.Bytes())
+			return page, nil
+		}
+		p.r.Discard(len(data))
+	}
+}
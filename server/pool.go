@@ -0,0 +1,439 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WorkerPool renders diagrams with a pool of PlantUML processes in -pipe mode
+//
+// This is the default Renderer. Create one with NewWorkerPool, then call Run
+// to start the workers.
+type WorkerPool struct {
+	// How many PlantUML sub-processes should we create to handle the rendering?
+	//
+	// Each worker spins up a goroutine that manages and reads from the sub-process.
+	//
+	// Acts as both MinWorkers and MaxWorkers when those are unset.
+	Workers int
+
+	// Bounds for autoscaling the number of workers (default: Workers)
+	//
+	// The pool starts at MinWorkers, growing by one whenever a request waits
+	// longer than ScaleUpWait for a worker. Workers idle for ScaleDownIdle
+	// exit until we're back to MinWorkers.
+	MinWorkers int
+	MaxWorkers int
+
+	// How long a request can wait for a worker before we add another (default: 500ms)
+	ScaleUpWait time.Duration
+
+	// How long a worker can sit idle before being removed (default: 5m)
+	ScaleDownIdle time.Duration
+
+	// Max requests waiting for a worker before shedding load (default: 0, unbounded)
+	//
+	// Requests over the limit fail fast with ResourceExhausted.
+	MaxQueue int
+
+	// Consecutive worker start failures before we stop trying (default: 5)
+	//
+	// Once tripped, requests fail fast with Unavailable when no workers are
+	// alive, and new workers are only attempted every BreakerCooldown. The
+	// first worker to warm up resets it.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Command-line args to Java and PlantUML (default: h.MakeWorkerArgs())
+	//
+	// Crafting your own arguments instead of amending the default ones may
+	// break assumptions. Create a Handler, then set this field ho
+	// h.MakeWorkerArgs() + your changes.
+	//
+	// Each worker appends "-pipedelimitor <delimiter>" itself.
+	WorkerArgs []string
+
+	// Extra Java options, like "-Dkey=value", placed before "-jar" (default: none)
+	//
+	// Ignored when WorkerArgs is set.
+	JavaOptions []string
+
+	// Upper bound to wait for a digram to render (default: 10s)
+	//
+	// Set high enough to only cancel problematic
+	// payloads. Value will vary based on configured workers and available
+	// CPU.
+	RenderTimeout time.Duration
+
+	// Replace a worker after it has rendered this many diagrams (default: 0, never)
+	//
+	// JVMs in -pipe mode slowly grow and occasionally degrade. Workers are only
+	// recycled between renders, so no in-flight request is affected.
+	MaxWorkerRenders int
+
+	// Replace a worker once it has been running this long (default: 0, never)
+	MaxWorkerAge time.Duration
+
+	// Replace a worker once its resident memory crosses this many bytes (default: 0, never)
+	//
+	// Read from /proc/<pid>/status after every render. Ignored on platforms
+	// without /proc.
+	MaxWorkerRSS int64
+
+	// Diagrams each worker renders, in every format, before taking requests (default: DefaultWarmupDiagrams)
+	//
+	// Leave empty to skip warming up.
+	WarmupDiagrams []string
+
+	// How many workers must be warm before Ready() reports true (default: 1)
+	//
+	// Capped at MinWorkers.
+	MinReadyWorkers int
+
+	// Fixed delimeter between diagrams over the PlantUML pipe (default: random per worker)
+	//
+	// Leave empty unless debugging. Each worker otherwise generates its own
+	// high-entropy delimiter so diagrams can't guess it to desynchronise the
+	// output stream. Diagrams containing the delimiter are rejected either way.
+	PipeDelimiter string
+
+	// Where will PlantUML look to import local themes, plugins, etc?
+	//
+	// We will ensure the path exists, failing-hard without the correct privileges.
+	SearchPath string
+
+	// Path to the Java binary. (default: "java" in $PATH)
+	JavaExe string
+
+	// Path to the Java binary. (default: "/usr/share/java/plantuml/plantuml.jar")
+	PlantUMLPath string
+
+	// Working directory of PlantUML processes (default: ours)
+	//
+	// PlantUML resolves relative includes against it, along with SearchPath.
+	// A relative PlantUMLPath is still resolved from our working directory.
+	Dir string
+
+	// Path to Graphviz's dot (default: "dot" in $PATH)
+	//
+	// Checked as each worker starts. Without it, diagrams that don't pick a
+	// layout use Smetana instead of rendering an error image.
+	GraphvizDot string
+
+	// Log diagrams as short codes instead of a digest (default: false)
+	//
+	// Diagrams may contain anything users draw, so leave this off unless
+	// debugging. Only logged at -v=2.
+	LogDiagrams bool
+
+	workerCh    chan workerReq
+	graphviz    int32 // atomic, see checkGraphviz
+	running     int64 // atomic
+	warmWorkers int64 // atomic
+	busyWorkers int64 // atomic
+	queued      int64 // atomic
+	breaker     *breaker
+
+	// Signals from requests and idle workers to Run
+	scaleUp   chan struct{}
+	scaleDown chan chan bool
+}
+
+// DefaultWarmupDiagrams exercise the common rendering paths
+//
+// The class diagram makes sure PlantUML has loaded Graphviz.
+var DefaultWarmupDiagrams = []string{
+	"@startuml\nAlice -> Bob: hello\nBob --> Alice: hi\n@enduml",
+	"@startuml\nclass Foo {\n  +bar(): int\n}\nFoo <|-- Baz\n@enduml",
+	"@startuml\nstart\n:warm up;\nif (ready?) then (yes)\n  stop\nendif\n@enduml",
+}
+
+// NewWorkerPool returns a pool with default settings
+func NewWorkerPool() *WorkerPool {
+	return &WorkerPool{
+		Workers:          runtime.NumCPU(),
+		ScaleUpWait:      time.Millisecond * 500,
+		ScaleDownIdle:    time.Minute * 5,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Second * 30,
+		RenderTimeout:    time.Second * 10,
+		JavaExe:          "java",
+		PlantUMLPath:     "/usr/share/java/plantuml/plantuml.jar",
+		SearchPath:       ".",
+		WarmupDiagrams:   DefaultWarmupDiagrams,
+		MinReadyWorkers:  1,
+		workerCh:         make(chan workerReq),
+		scaleUp:          make(chan struct{}, 1),
+		scaleDown:        make(chan chan bool),
+		breaker:          newBreaker(),
+	}
+}
+
+// WithPlantUML returns a copy of the pool's settings using another jar
+//
+// The copy has its own workers, so it can run alongside the original. Custom
+// WorkerArgs are kept as-is and must point at the jar themselves.
+func (wp *WorkerPool) WithPlantUML(path string) *WorkerPool {
+	c := NewWorkerPool()
+	workerCh, scaleUp, scaleDown, breaker := c.workerCh, c.scaleUp, c.scaleDown, c.breaker
+	*c = *wp
+	c.PlantUMLPath = path
+	c.workerCh, c.scaleUp, c.scaleDown, c.breaker = workerCh, scaleUp, scaleDown, breaker
+	c.running, c.warmWorkers, c.busyWorkers, c.queued, c.graphviz = 0, 0, 0, 0, graphvizUnknown
+	return c
+}
+
+func (wp *WorkerPool) GetWorkerArgs() []string {
+	if len(wp.WorkerArgs) > 0 {
+		return wp.WorkerArgs
+	}
+	return wp.MakeWorkerArgs()
+}
+
+func (wp *WorkerPool) MakeWorkerArgs() []string {
+	args := []string{fmt.Sprintf(`-Dplantuml.include.path="%s"`, wp.SearchPath)}
+	args = append(args, wp.JavaOptions...)
+	jar := wp.PlantUMLPath
+	if wp.Dir != "" && jar != "" && !filepath.IsAbs(jar) {
+		if abs, err := filepath.Abs(jar); err == nil {
+			jar = abs
+		}
+	}
+	return append(args,
+		"-jar",
+		jar,
+		"-headless",
+		"-pipe",
+	)
+}
+
+// pipeDelimiter returns PipeDelimiter if set, otherwise a random one
+func (wp *WorkerPool) pipeDelimiter() (string, error) {
+	if wp.PipeDelimiter != "" {
+		return wp.PipeDelimiter, nil
+	}
+	return newPipeDelimiter()
+}
+
+// Run initiates and maintains the right number of workers
+//
+// Logs from workers are prefixed with their number, and the ID of the request
+// they're rendering. The number may be larger than max workers as it increases
+// after crashes, recycling, and scaling.
+//
+// Returns only when ctx is done.
+func (wp *WorkerPool) Run(ctx context.Context) {
+	if wp.workerCh == nil {
+		wp.workerCh = make(chan workerReq)
+	}
+	if wp.scaleUp == nil {
+		wp.scaleUp = make(chan struct{}, 1)
+	}
+	if wp.scaleDown == nil {
+		wp.scaleDown = make(chan chan bool)
+	}
+	if wp.breaker == nil {
+		wp.breaker = newBreaker()
+	}
+
+	minWorkers, maxWorkers := wp.workerBounds()
+	target := minWorkers
+	exited := make(chan error)
+
+	// Start as many workers as able, new ones spinning up as old ones exit.
+	var i, running int
+	for {
+		// Paused while the breaker is cooling down
+		var retry <-chan time.Time
+		if at := wp.breaker.RetryAt(); time.Now().Before(at) {
+			retry = time.After(time.Until(at))
+		} else {
+			for running < target {
+				go func(i int) {
+					err := wp.worker(ctx, i)
+					select {
+					case exited <- err:
+					case <-ctx.Done():
+					}
+				}(i)
+				i++
+				running++
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-retry:
+			glog.Infof("retrying workers after %s cooldown", wp.BreakerCooldown)
+		case err := <-exited:
+			running--
+			if err != nil && wp.breaker.failure(err, wp.BreakerThreshold, wp.BreakerCooldown) {
+				glog.Errorf(
+					"workers failed to start %d+ times in a row, pausing for %s: %v",
+					wp.BreakerThreshold, wp.BreakerCooldown, err,
+				)
+			}
+		case <-wp.scaleUp:
+			// Workers still warming up will soon relieve the queue. Growing
+			// further would overshoot.
+			if target >= maxWorkers || atomic.LoadInt64(&wp.warmWorkers) < int64(running) {
+				continue
+			}
+			target++
+			glog.Infof("scaling up to %d workers, requests waited over %s", target, wp.ScaleUpWait)
+		case reply := <-wp.scaleDown:
+			ok := target > minWorkers
+			if ok {
+				target--
+				glog.Infof("scaling down to %d workers, worker idle for %s", target, wp.ScaleDownIdle)
+			}
+			reply <- ok
+		}
+	}
+}
+
+// workerBounds returns the min and max number of workers to run
+func (wp *WorkerPool) workerBounds() (int, int) {
+	minWorkers, maxWorkers := wp.MinWorkers, wp.MaxWorkers
+	if minWorkers <= 0 {
+		minWorkers = wp.Workers
+	}
+	if maxWorkers <= 0 {
+		maxWorkers = wp.Workers
+	}
+	if maxWorkers < minWorkers {
+		maxWorkers = minWorkers
+	}
+	return minWorkers, maxWorkers
+}
+
+// requestScaleDown asks Run if an idle worker may exit
+func (wp *WorkerPool) requestScaleDown(ctx context.Context) bool {
+	reply := make(chan bool, 1)
+	select {
+	case wp.scaleDown <- reply:
+		return <-reply
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Ready reports whether at least MinReadyWorkers have finished warming up
+func (wp *WorkerPool) Ready() bool {
+	minWorkers, _ := wp.workerBounds()
+	need := wp.MinReadyWorkers
+	if need > minWorkers {
+		need = minWorkers
+	}
+	return atomic.LoadInt64(&wp.warmWorkers) >= int64(need)
+}
+
+// Busy reports whether requests are waiting for a free worker
+func (wp *WorkerPool) Busy() bool {
+	return atomic.LoadInt64(&wp.queued) > 0
+}
+
+// Graphviz reports whether workers can use dot
+//
+// Assumed true until a worker has checked.
+func (wp *WorkerPool) Graphviz() bool {
+	return atomic.LoadInt32(&wp.graphviz) != graphvizMissing
+}
+
+// Render queues a diagram for the next free worker
+//
+// Returns as soon as ctx is done, whether still queued or rendering. Queued
+// requests are skipped by workers, and in-flight results are discarded.
+func (wp *WorkerPool) Render(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+	if err := wp.checkAvailable(); err != nil {
+		return nil, err
+	}
+
+	// Buffered so that workers never block on abandoned requests
+	ch := make(chan workerRes, 1)
+	req := workerReq{ctx: ctx, text: text, format: format, result: ch}
+	if err := wp.enqueue(ctx, req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case result := <-ch:
+		return result.data, result.err
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// enqueue hands req to the next free worker
+//
+// Requests waiting longer than ScaleUpWait for a worker ask Run to
+// add another. Fails fast when the queue is full, or when the breaker trips
+// with no workers left to drain it.
+func (wp *WorkerPool) enqueue(ctx context.Context, req workerReq) (err error) {
+	_, span := tracer().Start(ctx, "queue.wait")
+	defer func() { endSpan(span, err) }()
+
+	queued := atomic.AddInt64(&wp.queued, 1)
+	defer atomic.AddInt64(&wp.queued, -1)
+	if wp.MaxQueue > 0 && queued > int64(wp.MaxQueue) {
+		return status.Errorf(
+			codes.ResourceExhausted,
+			"render queue is full with %d requests waiting, try again later",
+			wp.MaxQueue,
+		)
+	}
+
+	var wait <-chan time.Time
+	if wp.ScaleUpWait > 0 {
+		t := time.NewTimer(wp.ScaleUpWait)
+		defer t.Stop()
+		wait = t.C
+	}
+
+	start := time.Now()
+	tripped := wp.breaker.Tripped()
+	for {
+		select {
+		case wp.workerCh <- req:
+			queueWait.Observe(time.Since(start).Seconds())
+			return nil
+		case <-wait:
+			select {
+			case wp.scaleUp <- struct{}{}:
+			default: // already signalled
+			}
+			wait = nil
+		case <-tripped:
+			if err := wp.checkAvailable(); err != nil {
+				return err
+			}
+			// Some workers are still alive to drain the queue
+			tripped = nil
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// checkAvailable fails if workers can't start and none are left running
+func (wp *WorkerPool) checkAvailable() error {
+	err := wp.breaker.Err()
+	if err == nil || atomic.LoadInt64(&wp.warmWorkers) > 0 {
+		return nil
+	}
+	return status.Errorf(
+		codes.Unavailable,
+		"no plantuml workers available (java: %q, plantuml: %q): %v",
+		wp.JavaExe, wp.PlantUMLPath, err,
+	)
+}
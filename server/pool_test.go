@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWorkerBounds(t *testing.T) {
+	table := []struct {
+		workers, min, max int
+		expMin, expMax    int
+	}{
+		{4, 0, 0, 4, 4},
+		{4, 1, 0, 1, 4},
+		{4, 1, 8, 1, 8},
+		{4, 0, 8, 4, 8},
+		{4, 6, 2, 6, 6},
+	}
+	for _, tc := range table {
+		wp := WorkerPool{Workers: tc.workers, MinWorkers: tc.min, MaxWorkers: tc.max}
+		gotMin, gotMax := wp.workerBounds()
+		if gotMin != tc.expMin || gotMax != tc.expMax {
+			t.Errorf(
+				"workers=%d min=%d max=%d: expected (%d, %d), got (%d, %d)",
+				tc.workers, tc.min, tc.max, tc.expMin, tc.expMax, gotMin, gotMax,
+			)
+		}
+	}
+}
+
+func TestPoolAutoscales(t *testing.T) {
+	wp := fakePool(t)
+	wp.MinWorkers, wp.MaxWorkers = 1, 2
+	wp.ScaleUpWait = time.Millisecond * 50
+	wp.ScaleDownIdle = time.Millisecond * 300
+	wp.WarmupDiagrams = nil
+	runPool(t, wp)
+
+	waitRunning := func(want int64) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second * 5)
+		for atomic.LoadInt64(&wp.running) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d workers, got %d", want, atomic.LoadInt64(&wp.running))
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	// Keep the only worker busy, so the next request waits past ScaleUpWait
+	ctx := context.Background()
+	go wp.Render(ctx, "@startuml\n' fake: sleep 2s\n@enduml", pb.Format_PNG)
+	time.Sleep(time.Millisecond * 50)
+	start := time.Now()
+	if _, err := wp.Render(ctx, "@startuml\nrectangle Foo\n@enduml", pb.Format_PNG); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected a new worker to take the request, waited %s", elapsed)
+	}
+	waitRunning(2)
+
+	// The extra worker is removed once it sits idle
+	waitRunning(1)
+}
+
+func TestPoolRenderCancelledWhileQueued(t *testing.T) {
+	// No workers are reading, so the request can only ever be queued.
+	wp := WorkerPool{workerCh: make(chan workerReq)}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	_, err := wp.Render(ctx, "@startuml\nrectangle Foo\n@enduml", pb.Format_PNG)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestRenderTimeout(t *testing.T) {
+	wp := WorkerPool{RenderTimeout: time.Second * 10}
+	if got := wp.renderTimeout(context.Background()); got != wp.RenderTimeout {
+		t.Errorf("expected %s without a deadline, got %s", wp.RenderTimeout, got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if got := wp.renderTimeout(ctx); got > time.Second {
+		t.Errorf("expected deadline to win, got %s", got)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if got := wp.renderTimeout(ctx); got != wp.RenderTimeout {
+		t.Errorf("expected %s to win over a later deadline, got %s", wp.RenderTimeout, got)
+	}
+}
+
+func TestPoolRenderFailsFastWithoutJava(t *testing.T) {
+	wp := WorkerPool{
+		Workers:          1,
+		JavaExe:          "/nonexistent/java",
+		PlantUMLPath:     "/nonexistent/plantuml.jar",
+		RenderTimeout:    time.Second,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+		workerCh:         make(chan workerReq),
+		breaker:          newBreaker(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wp.Run(ctx)
+
+	// Queued before the breaker trips, so this covers failing while waiting.
+	rctx, rcancel := context.WithTimeout(ctx, time.Second*5)
+	defer rcancel()
+	_, err := wp.Render(rctx, "@startuml\nrectangle Foo\n@enduml", pb.Format_PNG)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), wp.JavaExe) {
+		t.Errorf("expected error to mention %q, got: %v", wp.JavaExe, err)
+	}
+}
+
+func TestPoolRenderQueueFull(t *testing.T) {
+	// No workers are reading, so every request stays queued.
+	wp := WorkerPool{MaxQueue: 1, workerCh: make(chan workerReq)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go wp.Render(ctx, "@startuml\nrectangle Foo\n@enduml", pb.Format_PNG)
+	for atomic.LoadInt64(&wp.queued) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err := wp.Render(ctx, "@startuml\nrectangle Bar\n@enduml", pb.Format_PNG)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got: %v", err)
+	}
+}
+
+var fakePID = regexp.MustCompile(`fakeplantuml pid=(\d+) format=(\w+) page=(\d+)`)
+
+// fakeInfo returns the pid, format, and page a fakeplantuml image was made with
+func fakeInfo(t *testing.T, img []byte) (pid, format, page string) {
+	t.Helper()
+	m := fakePID.FindSubmatch(img)
+	if m == nil {
+		t.Fatalf("not a fakeplantuml image: %q", img)
+	}
+	return string(m[1]), string(m[2]), string(m[3])
+}
+
+func TestPoolPages(t *testing.T) {
+	wp := fakePool(t)
+	runPool(t, wp)
+
+	text := "@startuml\nrectangle Foo\n@enduml\n@startuml\nrectangle Bar\n@enduml"
+	for _, format := range []pb.Format{pb.Format_PNG, pb.Format_SVG} {
+		data, err := wp.Render(context.Background(), text, format)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(data) != 2 {
+			t.Fatalf("expected 2 pages, got %d", len(data))
+		}
+		for i, page := range data {
+			_, gotFormat, gotPage := fakeInfo(t, page)
+			if gotFormat != strings.ToLower(format.String()) || gotPage != fmt.Sprint(i+1) {
+				t.Errorf("page %d: expected %s page %d, got %s page %s", i, format, i+1, gotFormat, gotPage)
+			}
+		}
+	}
+}
+
+func TestPoolRecyclesWorkers(t *testing.T) {
+	wp := fakePool(t)
+	wp.MaxWorkerRenders = 2
+	runPool(t, wp)
+
+	var pids []string
+	for i := 0; i < 3; i++ {
+		data, err := wp.Render(context.Background(), "@startuml\nrectangle Foo\n@enduml", pb.Format_SVG)
+		if err != nil {
+			t.Fatalf("render %d: unexpected error: %v", i, err)
+		}
+		pid, _, _ := fakeInfo(t, data[0])
+		pids = append(pids, pid)
+	}
+	if pids[0] != pids[1] {
+		t.Errorf("expected the first two renders on one process, got pids %v", pids)
+	}
+	if pids[1] == pids[2] {
+		t.Errorf("expected a new process after %d renders, got pids %v", wp.MaxWorkerRenders, pids)
+	}
+}
+
+func TestPoolRenderTimeoutKillsWorker(t *testing.T) {
+	wp := fakePool(t)
+	wp.RenderTimeout = time.Millisecond * 200
+	runPool(t, wp)
+
+	ctx := context.Background()
+	_, err := wp.Render(ctx, "@startuml\n' fake: sleep 10s\n@enduml", pb.Format_PNG)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got: %v", err)
+	}
+
+	// The stuck process is replaced.
+	if _, err := wp.Render(ctx, "@startuml\nrectangle Foo\n@enduml", pb.Format_PNG); err != nil {
+		t.Errorf("expected render after timeout to succeed, got: %v", err)
+	}
+}
+
+func TestPoolWorkerCrash(t *testing.T) {
+	wp := fakePool(t)
+	runPool(t, wp)
+
+	ctx := context.Background()
+	if _, err := wp.Render(ctx, "@startuml\n' fake: crash\n@enduml", pb.Format_PNG); err == nil {
+		t.Fatalf("expected an error when the worker crashes")
+	}
+	if _, err := wp.Render(ctx, "@startuml\nrectangle Foo\n@enduml", pb.Format_PNG); err != nil {
+		t.Errorf("expected render after crash to succeed, got: %v", err)
+	}
+}
+
+func TestPoolErrorImage(t *testing.T) {
+	wp := fakePool(t)
+	runPool(t, wp)
+
+	// PlantUML renders syntax errors rather than failing.
+	data, err := wp.Render(context.Background(), "@startuml\n' fake: error\n@enduml", pb.Format_SVG)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data[0]), "error=syntax") {
+		t.Errorf("expected an error image, got: %s", data[0])
+	}
+}
+
+func TestPoolReadyAfterWarmup(t *testing.T) {
+	wp := fakePool(t, "-fake-startup-delay", "300ms")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wp.Run(ctx)
+
+	if wp.Ready() {
+		t.Errorf("expected pool not to be ready while the worker starts")
+	}
+	waitReady(t, wp)
+}
+
+func TestPoolWarmsUpBeforeReady(t *testing.T) {
+	wp := fakePool(t)
+	wp.WarmupDiagrams = []string{"@startuml\n' fake: sleep 200ms\nrectangle Warm\n@enduml"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wp.Run(ctx)
+
+	time.Sleep(time.Millisecond * 100)
+	if wp.Ready() {
+		t.Errorf("expected pool not to be ready while warming up")
+	}
+	waitReady(t, wp)
+
+	// The warm-up diagram was rendered as both PNG and SVG first
+	data, err := wp.Render(ctx, "@startuml\nrectangle Foo\n@enduml", pb.Format_SVG)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data[0]), "render=3 ") {
+		t.Errorf("expected warm-up renders before the first request, got: %s", data[0])
+	}
+}
+
+func TestPoolWorkerFailsToStart(t *testing.T) {
+	wp := fakePool(t, "-fake-fail-start")
+	wp.BreakerThreshold = 2
+	wp.BreakerCooldown = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wp.Run(ctx)
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second*5)
+	defer rcancel()
+	_, err := wp.Render(rctx, "@startuml\nrectangle Foo\n@enduml", pb.Format_PNG)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable, got: %v", err)
+	}
+	if wp.Ready() {
+		t.Errorf("expected pool with failing workers not to be ready")
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// prefillPoll is how often prefill checks whether it can take a worker
+const prefillPoll = time.Millisecond * 100
+
+// DefaultPrefillFormats are what .puml files are rendered as, unless
+// handler.PrefillFormats says otherwise
+var DefaultPrefillFormats = []pb.Format{pb.Format_PNG, pb.Format_SVG}
+
+// prefillSources are rendered in every prefill format
+var prefillSources = map[string]bool{".puml": true, ".plantuml": true, ".pu": true, ".wsd": true}
+
+// prefillImages are rendered again from their metadata, in their own format
+var prefillImages = map[string]pb.Format{".png": pb.Format_PNG, ".svg": pb.Format_SVG}
+
+// prefillWhenReady waits for warm workers, then prefills all of PrefillDir
+func (h *handler) prefillWhenReady(ctx context.Context) {
+	ticker := time.NewTicker(prefillPoll)
+	defer ticker.Stop()
+	for !h.Ready() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+
+	glog.Infof("prefilling render cache from %s", h.PrefillDir)
+	resp, err := h.prefill(ctx, h.PrefillDir, h.prefillFormats())
+	if err != nil {
+		glog.Errorf("unable to prefill render cache: %v", err)
+		return
+	}
+	glog.Infof(
+		"prefilled render cache: rendered=%d cached=%d failed=%d skipped=%d",
+		resp.Rendered, resp.Cached, resp.Failed, resp.Skipped,
+	)
+}
+
+// Prefill renders diagrams under PrefillDir into the cache
+//
+// Uses .puml, .plantuml, .pu, and .wsd files, and PNG and SVG images that
+// PlantUML kept the diagram text in.
+func (h *handler) Prefill(ctx context.Context, req *pb.PrefillRequest) (*pb.PrefillResponse, error) {
+	if h.PrefillDir == "" {
+		return nil, status.Error(codes.FailedPrecondition, "prefill directory isn't set on this server")
+	}
+	// Relative to PrefillDir, and cleaned as if it were the root so ".."
+	// can't leave it
+	root := filepath.Join(h.PrefillDir, filepath.Clean("/"+req.Path))
+	if _, err := os.Stat(root); err != nil {
+		return nil, status.Errorf(codes.NotFound, "%q isn't in the prefill directory", req.Path)
+	}
+	formats := req.Formats
+	if len(formats) == 0 {
+		formats = h.prefillFormats()
+	}
+	for _, f := range formats {
+		if f == pb.Format_UNSPECIFIED {
+			return nil, status.Error(codes.InvalidArgument, "must give a format to prefill")
+		}
+	}
+	return h.prefill(ctx, root, formats)
+}
+
+func (h *handler) prefillFormats() []pb.Format {
+	if len(h.PrefillFormats) > 0 {
+		return h.PrefillFormats
+	}
+	return DefaultPrefillFormats
+}
+
+// prefill renders every diagram under root into the cache, one at a time
+//
+// Hidden files and directories are skipped. Renders wait until no other
+// requests are queued, so prefilling never delays real traffic.
+func (h *handler) prefill(ctx context.Context, root string, formats []pb.Format) (*pb.PrefillResponse, error) {
+	if h.Cache == nil && h.DiskCache == nil {
+		return nil, status.Error(codes.FailedPrecondition, "no render cache to prefill")
+	}
+	if !atomic.CompareAndSwapInt32(&h.prefilling, 0, 1) {
+		return nil, status.Error(codes.Aborted, "a prefill is already running")
+	}
+	defer atomic.StoreInt32(&h.prefilling, 0)
+
+	resp := &pb.PrefillResponse{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			glog.Warningf("unable to prefill %s: %v", path, err)
+			resp.Failed++
+			return nil
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		reqs, err := prefillRequests(path, formats, h.defaultLayout())
+		if err != nil {
+			glog.Warningf("unable to prefill %s: %v", path, err)
+			resp.Failed++
+			return nil
+		}
+		if reqs == nil {
+			return nil
+		}
+		if len(reqs) == 0 {
+			resp.Skipped++
+			return nil
+		}
+		for _, req := range reqs {
+			if err := h.prefillOne(ctx, req, resp); err != nil {
+				glog.Warningf("unable to prefill %s as %s: %v", path, req.Format, err)
+				resp.Failed++
+			}
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// prefillOne renders req unless it's already cached in memory
+//
+// Renders found on disk are still loaded, to fill the memory cache from them,
+// but count as cached.
+func (h *handler) prefillOne(ctx context.Context, req *pb.RenderRequest, resp *pb.PrefillResponse) error {
+	key, err := h.requestKey(ctx, req)
+	if err != nil {
+		return err
+	}
+	onDisk := h.DiskCache != nil && h.DiskCache.Contains(key)
+	cached := h.Cache == nil && onDisk
+	if c, ok := h.Cache.(interface {
+		Contains(context.Context, string) (bool, error)
+	}); ok {
+		cached, _ = c.Contains(ctx, key)
+	}
+	if cached {
+		resp.Cached++
+		return nil
+	}
+
+	if err := h.waitIdle(ctx); err != nil {
+		return err
+	}
+	if _, err := h.Render(ctx, req); err != nil {
+		return err
+	}
+	if onDisk {
+		resp.Cached++
+	} else {
+		resp.Rendered++
+	}
+	return nil
+}
+
+// waitIdle blocks while any backend has requests waiting for a worker
+func (h *handler) waitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(prefillPoll)
+	defer ticker.Stop()
+	for h.busy() {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (h *handler) busy() bool {
+	for _, wp := range h.pools() {
+		if wp.Busy() {
+			return true
+		}
+	}
+	if r, ok := h.Renderer.(interface{ Busy() bool }); ok {
+		return r.Busy()
+	}
+	return false
+}
+
+// defaultLayout is what requests without a layout end up rendered with
+func (h *handler) defaultLayout() pb.Layout {
+	version, err := h.resolveVersion("")
+	if err != nil {
+		return pb.Layout_DEFAULT_LAYOUT
+	}
+	layout, _ := resolveLayout(h.backend(version), pb.Layout_DEFAULT_LAYOUT)
+	return layout
+}
+
+// prefillRequests returns what to render for the file at path
+//
+// Returns nil for files that aren't diagrams, and an empty slice for images
+// without diagram text. Layout pragmas that Render added to images are
+// removed, so the request matches the one that produced them: pragmas for
+// defaultLayout are taken as a request without a layout.
+func prefillRequests(path string, formats []pb.Format, defaultLayout pb.Layout) ([]*pb.RenderRequest, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	imageFormat, isImage := prefillImages[ext]
+	if !prefillSources[ext] && !isImage {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isImage {
+		var reqs []*pb.RenderRequest
+		for _, f := range formats {
+			reqs = append(reqs, &pb.RenderRequest{Diagram: &pb.Diagram{Full: string(data)}, Format: f})
+		}
+		return reqs, nil
+	}
+
+	metadata := ExtractFromImage(data)
+	if metadata == "" {
+		return []*pb.RenderRequest{}, nil
+	}
+	original, _ := divideMetadata(metadata)
+	text, layout := withoutLayout(normalizeText(original))
+	if layout == defaultLayout {
+		layout = pb.Layout_DEFAULT_LAYOUT
+	}
+	return []*pb.RenderRequest{{
+		Diagram: &pb.Diagram{Full: text},
+		Format:  imageFormat,
+		Layout:  layout,
+	}}, nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coxley/pmlproxy/fakeplantuml"
+	"github.com/coxley/pmlproxy/pb"
+)
+
+func TestPrefill(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	elk := withLayout("@startuml\nrectangle Bar\n@enduml", pb.Layout_ELK)
+	files := map[string][]byte{
+		"a.puml":         []byte("@startuml\nrectangle Foo\n@enduml"),
+		"sub/b.svg":      fakeplantuml.SVG(elk, "1.2022.7", "Bar"),
+		"sub/blank.png":  []byte("\x89PNG\r\n\x1a\n"),
+		"sub/notes.txt":  []byte("not a diagram"),
+		".drafts/c.puml": []byte("@startuml\nrectangle Draft\n@enduml"),
+	}
+	for name, data := range files {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), data, 0644)
+	}
+
+	h := &handler{Cache: NewLRUCache(1<<20, 0), Renderer: echoRenderer, PrefillDir: dir}
+	resp, err := h.Prefill(ctx, &pb.PrefillRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a.puml as PNG and SVG, and b.svg as itself
+	if resp.Rendered != 3 || resp.Cached != 0 || resp.Failed != 0 || resp.Skipped != 1 {
+		t.Errorf("unexpected counts: %v", resp)
+	}
+
+	// Cached under the request that produced the image
+	req := &pb.RenderRequest{
+		Diagram: &pb.Diagram{Full: "@startuml\nrectangle Bar\n@enduml"},
+		Format:  pb.Format_SVG,
+		Layout:  pb.Layout_ELK,
+	}
+	lookup, _ := h.LookupCache(ctx, &pb.LookupCacheRequest{Request: req})
+	if !lookup.Cached {
+		t.Errorf("expected image's diagram to be cached")
+	}
+
+	resp, err = h.Prefill(ctx, &pb.PrefillRequest{Path: "../../sub"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Rendered != 0 || resp.Cached != 1 {
+		t.Errorf("expected only sub/ to be prefilled from cache: %v", resp)
+	}
+
+	h.PrefillDir = ""
+	if _, err := h.Prefill(ctx, &pb.PrefillRequest{}); err == nil {
+		t.Errorf("expected an error without a prefill directory")
+	}
+}
+
+func TestPrefillOnStart(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.puml"), []byte("@startuml\nrectangle Foo\n@enduml"), 0644)
+
+	cache := NewLRUCache(1<<20, 0)
+	h := &handler{WorkerPool: *fakePool(t), Cache: cache, PrefillDir: dir}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.ManageWorkers(ctx)
+
+	deadline := time.Now().Add(time.Second * 10)
+	for cache.Len() < len(DefaultPrefillFormats) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a render per format after start, got %d", cache.Len())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+type busyRenderer struct {
+	Renderer
+	busy int32
+}
+
+func (r *busyRenderer) Busy() bool {
+	return atomic.LoadInt32(&r.busy) == 1
+}
+
+func TestPrefillWaitsForIdle(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.puml"), []byte("@startuml\nrectangle Foo\n@enduml"), 0644)
+
+	var renders int32
+	r := &busyRenderer{busy: 1, Renderer: RendererFunc(func(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+		atomic.AddInt32(&renders, 1)
+		return [][]byte{[]byte(text)}, nil
+	})}
+	h := &handler{Cache: NewLRUCache(1<<20, 0), Renderer: r, PrefillDir: dir}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Prefill(context.Background(), &pb.PrefillRequest{Formats: []pb.Format{pb.Format_SVG}})
+	}()
+	time.Sleep(prefillPoll * 3)
+	if atomic.LoadInt32(&renders) != 0 {
+		t.Errorf("expected prefill to wait while the renderer is busy")
+	}
+	atomic.StoreInt32(&r.busy, 0)
+	<-done
+	if renders != 1 {
+		t.Errorf("expected a render once idle, got %d", renders)
+	}
+}
+
+func TestWithoutLayout(t *testing.T) {
+	text := "@startuml\nrectangle Foo\n@enduml\n@startmindmap\n* root\n@endmindmap"
+	for _, layout := range []pb.Layout{pb.Layout_SMETANA, pb.Layout_ELK} {
+		got, gotLayout := withoutLayout(withLayout(text, layout))
+		if got != text || gotLayout != layout {
+			t.Errorf("expected %q with %s, got %q with %s", text, layout, got, gotLayout)
+		}
+	}
+}
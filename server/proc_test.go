@@ -0,0 +1,54 @@
+package server
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+var procStatus = `Name:	java
+Umask:	0022
+State:	S (sleeping)
+Pid:	4242
+VmPeak:	 5402680 kB
+VmSize:	 5336120 kB
+VmHWM:	  421784 kB
+VmRSS:	  412340 kB
+RssAnon:	  389120 kB
+Threads:	31
+`
+
+func TestParseRSS(t *testing.T) {
+	table := []struct {
+		status   string
+		expected int64
+		err      bool
+	}{
+		{procStatus, 412340 * 1024, false},
+		{"Name:\tjava\n", 0, true},
+		{"VmRSS:\t  12 MB\n", 0, true},
+		{"VmRSS:\t  abc kB\n", 0, true},
+	}
+	for _, tc := range table {
+		got, err := parseRSS(strings.NewReader(tc.status))
+		if (err != nil) != tc.err {
+			t.Errorf("unexpected error state: %v\nstatus: %q", err, tc.status)
+		}
+		if got != tc.expected {
+			t.Errorf("expected %d bytes, got %d\nstatus: %q", tc.expected, got, tc.status)
+		}
+	}
+}
+
+func TestReadRSSSelf(t *testing.T) {
+	if _, err := os.Stat("/proc/self/status"); err != nil {
+		t.Skip("no /proc on this platform")
+	}
+	rss, err := readRSS(os.Getpid())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rss <= 0 {
+		t.Errorf("expected positive RSS, got %d", rss)
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coxley/pmlproxy/pb"
+	"github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RemoteRenderer forwards renders to upstream PlantUML servers over HTTP
+//
+// Upstreams are base URLs of a plantuml-server, or another pmlproxy serving
+// HTTPHandler. Diagrams are sent with PlantUML's encoded-URL scheme, one
+// request per @startXYZ/@endXYZ pair:
+//
+//	GET <upstream>/png/<short>
+//
+// Requests are spread round-robin across upstreams. One that fails is skipped
+// for FailureCooldown, unless every upstream has failed.
+type RemoteRenderer struct {
+	// Base URLs, eg: http://plantuml.internal:8080
+	Upstreams []string
+
+	// Shared client so connections are pooled (default: NewRemoteRenderer's)
+	Client *http.Client
+
+	// Upper bound for each attempt against an upstream (default: 10s)
+	Timeout time.Duration
+
+	// How long to skip an upstream after it fails (default: 30s)
+	FailureCooldown time.Duration
+
+	next      uint32 // atomic
+	mu        sync.Mutex
+	downUntil map[string]time.Time
+}
+
+// NewRemoteRenderer returns a renderer with a pooled HTTP client
+func NewRemoteRenderer(upstreams ...string) *RemoteRenderer {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   time.Second * 5,
+			KeepAlive: time.Second * 30,
+		}).DialContext,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     time.Second * 90,
+	}
+	return &RemoteRenderer{
+		Upstreams:       upstreams,
+		Client:          &http.Client{Transport: transport},
+		Timeout:         time.Second * 10,
+		FailureCooldown: time.Second * 30,
+	}
+}
+
+func (r *RemoteRenderer) Render(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+	if len(r.Upstreams) == 0 {
+		return nil, status.Error(codes.FailedPrecondition, "no upstreams configured for remote rendering")
+	}
+
+	normalized := normalizeText(text)
+	if _, err := validate(normalized); err != nil {
+		return nil, err
+	}
+
+	var pages [][]byte
+	for _, diagram := range splitDiagrams(normalized) {
+		page, err := r.renderOne(ctx, diagram, format)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// renderOne tries each upstream in turn until one returns an image
+func (r *RemoteRenderer) renderOne(ctx context.Context, diagram string, format pb.Format) ([]byte, error) {
+	short, err := ToShort(diagram)
+	if err != nil {
+		return nil, err
+	}
+	path := "/" + strings.ToLower(format.String()) + "/" + short
+
+	var lastErr error
+	for _, upstream := range r.upstreamOrder() {
+		data, retry, err := r.fetch(ctx, upstream+path)
+		if err == nil {
+			return data, nil
+		}
+		if !retry {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		glog.Warningf("upstream failed, trying next: %s", logFields(ctx, "upstream", upstream, "error", err))
+		r.markDown(upstream)
+		lastErr = err
+	}
+	return nil, status.Errorf(codes.Unavailable, "all upstreams failed, last error: %v", lastErr)
+}
+
+// fetch returns whether the error is worth retrying on another upstream
+func (r *RemoteRenderer) fetch(ctx context.Context, url string) ([]byte, bool, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return body, false, nil
+	case resp.StatusCode == http.StatusBadRequest && isImage(resp.Header.Get("Content-Type")):
+		// plantuml-server returns syntax errors as images, like -pipe does
+		return body, false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return nil, true, fmt.Errorf("upstream returned %s", resp.Status)
+	default:
+		return nil, false, status.Errorf(
+			codes.InvalidArgument,
+			"upstream rejected diagram with %s: %s", resp.Status, strings.TrimSpace(string(body)),
+		)
+	}
+}
+
+func isImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+// upstreamOrder starts at the next upstream in rotation, healthy ones first
+func (r *RemoteRenderer) upstreamOrder() []string {
+	n := len(r.Upstreams)
+	start := int(atomic.AddUint32(&r.next, 1)-1) % n
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var healthy, down []string
+	for i := 0; i < n; i++ {
+		u := r.Upstreams[(start+i)%n]
+		if now.Before(r.downUntil[u]) {
+			down = append(down, u)
+		} else {
+			healthy = append(healthy, u)
+		}
+	}
+	return append(healthy, down...)
+}
+
+func (r *RemoteRenderer) markDown(upstream string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.downUntil == nil {
+		r.downUntil = make(map[string]time.Time)
+	}
+	r.downUntil[upstream] = time.Now().Add(r.FailureCooldown)
+}
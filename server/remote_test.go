@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRemoteRendererFailover(t *testing.T) {
+	var badHits int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badHits, 1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	// Serve through a pmlproxy so we exercise HTTPHandler too
+	good := httptest.NewServer(HTTPHandler(&handler{Renderer: echoRenderer}))
+	defer good.Close()
+
+	r := NewRemoteRenderer(bad.URL, good.URL)
+	text := "@startuml\nrectangle Foo\n@enduml\n@startuml\nrectangle Bar\n@enduml"
+	for i := 0; i < 4; i++ {
+		pages, err := r.Render(context.Background(), text, pb.Format_SVG)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(pages) != 2 {
+			t.Fatalf("expected 2 pages, got %d", len(pages))
+		}
+		if got := string(pages[1]); got != "SVG:@startuml\nrectangle Bar\n@enduml" {
+			t.Errorf("unexpected page: %q", got)
+		}
+	}
+
+	// After failing once, the bad upstream is skipped during its cooldown
+	if n := atomic.LoadInt32(&badHits); n != 1 {
+		t.Errorf("expected bad upstream to be tried once, got %d", n)
+	}
+}
+
+func TestRemoteRendererAllDown(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusBadGateway)
+	}))
+	defer bad.Close()
+
+	r := NewRemoteRenderer(bad.URL)
+	_, err := r.Render(context.Background(), "@startuml\nrectangle Foo\n@enduml", pb.Format_PNG)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable, got: %v", err)
+	}
+}
+
+func TestRemoteRendererErrorImage(t *testing.T) {
+	var path string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("error image"))
+	}))
+	defer upstream.Close()
+
+	r := NewRemoteRenderer(upstream.URL)
+	pages, err := r.Render(context.Background(), "@startuml\nfoo bar baz\n@enduml", pb.Format_PNG)
+	if err != nil {
+		t.Fatalf("expected error image to be returned as a page, got: %v", err)
+	}
+	if string(pages[0]) != "error image" {
+		t.Errorf("unexpected page: %q", pages[0])
+	}
+	if !strings.HasPrefix(path, "/png/") {
+		t.Errorf("expected encoded-url path, got: %v", path)
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	srv := httptest.NewServer(HTTPHandler(&handler{Renderer: echoRenderer}))
+	defer srv.Close()
+
+	short, _ := ToShort("@startuml\nrectangle Foo\n@enduml")
+	table := []struct {
+		path        string
+		code        int
+		contentType string
+	}{
+		{"/svg/" + short, http.StatusOK, "image/svg+xml"},
+		{"/png/" + short, http.StatusOK, "image/png"},
+		{"/gif/" + short, http.StatusNotFound, ""},
+		{"/png/", http.StatusNotFound, ""},
+	}
+	for _, tc := range table {
+		resp, err := http.Get(srv.URL + tc.path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.code {
+			t.Errorf("%s: expected %d, got %d", tc.path, tc.code, resp.StatusCode)
+		}
+		if tc.contentType != "" && resp.Header.Get("Content-Type") != tc.contentType {
+			t.Errorf("%s: expected %s, got %s", tc.path, tc.contentType, resp.Header.Get("Content-Type"))
+		}
+	}
+}
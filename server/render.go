@@ -2,21 +2,40 @@ package server
 
 import (
 	"bufio"
-	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/coxley/pmlproxy/pb"
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+var warmupDuration = prometheus.NewSummary(prometheus.SummaryOpts{
+	Namespace:  "PlantUML",
+	Name:       "worker_warmup_seconds",
+	MaxAge:     time.Minute * 10,
+	Help:       "duration for a new worker to render the warm-up diagrams",
+	Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+})
+
+func init() {
+	prometheus.MustRegister(warmupDuration)
+}
+
 type workerReq struct {
+	ctx    context.Context
 	text   string
 	format pb.Format
 	result chan workerRes
@@ -38,20 +57,40 @@ type workerRes struct {
 //
 // Image format is specified by prepending @@@format <type> before the diagram.
 //   - https://forum.plantuml.net/10808/is-there-a-way-to-use-multiple-output-formats-with-pipe
-func (h *handler) worker(ctx context.Context, id int) {
+//
+// Workers retire themselves between jobs once they cross one of the recycling
+// thresholds (renders, age, or RSS). Since workerCh is unbuffered, nothing is
+// queued on a worker when it exits — Run spawns a fresh one.
+//
+// Returns an error only if the worker never became ready to take requests.
+func (wp *WorkerPool) worker(ctx context.Context, id int) error {
 	glog.Infof("[%d] starting worker", id)
-	cctx, cancelCmd := context.WithCancel(ctx)
-	cmd := exec.CommandContext(cctx, h.JavaExe, h.GetWorkerArgs()...)
+	atomic.AddInt64(&wp.running, 1)
+	defer atomic.AddInt64(&wp.running, -1)
+	if err := wp.checkWorkerPaths(); err != nil {
+		glog.Errorf("[%d] worker can't start: %v", id, err)
+		return err
+	}
 
-	// Clean-up process on return
+	delim, err := wp.pipeDelimiter()
+	if err != nil {
+		glog.Errorf("[%d] worker failed to create pipe delimiter: %v", id, err)
+		return err
+	}
+	// Copied so concurrent workers never share WorkerArgs' backing array
+	args := append(append([]string{}, wp.GetWorkerArgs()...), "-pipedelimitor", delim)
+	if dot := wp.checkGraphviz(id); dot != "" {
+		args = append(args, "-graphvizdot", dot)
+	}
+
+	cctx, cancelCmd := context.WithCancel(ctx)
+	cmd := exec.CommandContext(cctx, wp.JavaExe, args...)
+	cmd.Dir = wp.Dir
 	defer cancelCmd()
-	defer func() {
-		if err := cmd.Process.Kill(); err != nil {
-			// Should only reach in exceptional cases
-			glog.Errorf("[%d] failed to kill java proc: %v", id, err)
-		}
-		cmd.Wait()
-	}()
+
+	// Set when the worker retires on purpose, giving PlantUML a chance to exit
+	// on its own before being killed.
+	var retiring bool
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
@@ -62,28 +101,117 @@ func (h *handler) worker(ctx context.Context, id int) {
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		glog.Errorf("[%d] worker failed to bind stdin: %v", id, err)
-		return
+		return err
 	}
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		glog.Errorf("[%d] worker failed to bind stdout: %v", id, err)
-		return
+		return err
 	}
 
 	if err := cmd.Start(); err != nil {
 		glog.Errorf("[%d] worker failed to start process: %v", id, err)
-		return
+		return fmt.Errorf("failed to start %q: %w", wp.JavaExe, err)
 	}
 
+	// Clean-up process on return
+	defer func() {
+		var grace time.Duration
+		if retiring {
+			grace = workerStopGrace
+		}
+		stopProcess(id, cmd, stdin, grace)
+	}()
+
 	glog.Infof("[%d] plantuml process started: %v", id, cmd)
+	workerStarts.Inc()
+	started := time.Now()
+	var renders int
+
+	proc := &pipeProc{
+		id:    id,
+		stdin: stdin,
+		// PlantUML outputs the delimiter followed by a newline.
+		stdout:      newPipeReader(stdout, []byte(delim+"\n")),
+		kill:        cancelCmd,
+		logDiagrams: wp.LogDiagrams,
+	}
+
+	// Without warm-up diagrams, a broken install is only noticed on the
+	// first request.
+	workerStates.WithLabelValues("warming").Inc()
+	err = wp.warmUp(proc)
+	workerStates.WithLabelValues("warming").Dec()
+	if err != nil {
+		glog.Errorf("[%d] exiting worker, warm-up failed: %v", id, err)
+		workerCrashes.Inc()
+		return fmt.Errorf("warm-up failed for %q: %w", wp.PlantUMLPath, err)
+	}
+	wp.breaker.success()
+	atomic.AddInt64(&wp.warmWorkers, 1)
+	defer atomic.AddInt64(&wp.warmWorkers, -1)
+	idleWorkers := workerStates.WithLabelValues("idle")
+	busyWorkers := workerStates.WithLabelValues("busy")
+	idleWorkers.Inc()
+	defer idleWorkers.Dec()
 
-	// PlantUML outputs the delimiter followed by a newline.
-	splitOn := []byte(h.PipeDelimiter + "\n")
-	buf := make([]byte, 4)
+	var maxAge <-chan time.Time
+	if wp.MaxWorkerAge > 0 {
+		t := time.NewTimer(wp.MaxWorkerAge)
+		defer t.Stop()
+		maxAge = t.C
+	}
+
+	// Idle workers offer to exit so the pool can shrink back to MinWorkers.
+	var idle <-chan time.Time
+	resetIdle := func() {}
+	if wp.ScaleDownIdle > 0 {
+		t := time.NewTimer(wp.ScaleDownIdle)
+		defer t.Stop()
+		idle = t.C
+		resetIdle = func() {
+			if !t.Stop() {
+				select {
+				case <-t.C:
+				default:
+				}
+			}
+			t.Reset(wp.ScaleDownIdle)
+		}
+	}
+
+	for {
+		var j workerReq
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-maxAge:
+			glog.Infof("[%d] recycling worker, reached max age of %s", id, wp.MaxWorkerAge)
+			retiring = true
+			return nil
+		case <-idle:
+			if wp.requestScaleDown(ctx) {
+				glog.Infof("[%d] exiting worker, idle for %s", id, wp.ScaleDownIdle)
+				retiring = true
+				return nil
+			}
+			resetIdle()
+			continue
+		case j = <-wp.workerCh:
+			resetIdle()
+		}
+
+		// Caller gave up while queued
+		if err := j.ctx.Err(); err != nil {
+			j.result <- workerRes{err: status.FromContextError(err).Err()}
+			continue
+		}
 
-	for j := range h.workerCh {
 		normalized := normalizeText(j.text)
 		pageCnt, err := validate(normalized)
+		if err == nil {
+			err = checkDelimiter(normalized, delim)
+		}
 		if err != nil {
 			j.result <- workerRes{
 				data: nil,
@@ -92,41 +220,20 @@ func (h *handler) worker(ctx context.Context, id int) {
 			continue
 		}
 
-		deadline := time.AfterFunc(h.RenderTimeout, func() {
-			glog.Errorf("[%d] aborting worker, diagram took over %s", id, h.RenderTimeout)
-			cancelCmd() // will close the buffer we're reading from
-		})
-		data, err := func() ([][]byte, error) {
-			// TODO: Expose counter for busy vs. free worker
-			defer deadline.Stop()
-			short, _ := ToShort(j.text)
-			glog.Infof("[%d] rendering %d diagram(s): %s", id, pageCnt, short)
-			fmt.Fprint(stdin, addFormatSpec(normalized, j.format))
-
-			// TODO: Log about multiple pages
-			var res [][]byte
-			var cur []byte
-			var found int
-			for found < pageCnt {
-				if bytes.HasSuffix(cur, splitOn) {
-					cur = cur[:len(cur)-len(splitOn)]
-					res = append(res, cur)
-					found++
-					cur = nil
-					glog.Infof(
-						"[%d] found separator, diagram %d/%d size: %d bytes",
-						id, found, pageCnt, len(res[found-1]),
-					)
-					continue
-				}
-				n, err := stdout.Read(buf)
-				if err != nil {
-					return nil, fmt.Errorf("error reading diagram: %v", err)
-				}
-				cur = append(cur, buf[:n]...)
-			}
-			return res, nil
-		}()
+		idleWorkers.Dec()
+		busyWorkers.Inc()
+		atomic.AddInt64(&wp.busyWorkers, 1)
+		_, span := tracer().Start(j.ctx, "plantuml.render", trace.WithAttributes(
+			attrWorker.Int(id),
+			attrFormat.String(formatLabel(j.format)),
+			attrPages.Int(pageCnt),
+		))
+		reqID := RequestID(j.ctx)
+		data, err := proc.render(reqID, normalized, pageCnt, j.format, wp.renderTimeout(j.ctx))
+		endSpan(span, err)
+		atomic.AddInt64(&wp.busyWorkers, -1)
+		busyWorkers.Dec()
+		idleWorkers.Inc()
 		res := workerRes{
 			data: data,
 			err:  err,
@@ -136,10 +243,263 @@ func (h *handler) worker(ctx context.Context, id int) {
 		// Errors seen after data is sent to the sub-process make it hard to
 		// know what state PlantUML is in.
 		if err != nil {
-			glog.Errorf("[%d] exiting worker due to error: %v", id, err)
+			glog.Errorf("%s exiting worker due to error: %v", workerTag(id, reqID), err)
+			if status.Code(err) == codes.DeadlineExceeded {
+				workerTimeouts.Inc()
+			} else {
+				workerCrashes.Inc()
+			}
+			return nil
+		}
+
+		renders++
+		if reason := wp.recycleReason(cmd.Process.Pid, renders, started); reason != "" {
+			glog.Infof("[%d] recycling worker, %s", id, reason)
+			retiring = true
+			return nil
+		}
+	}
+}
+
+// pipeProc is the stdin/stdout of a PlantUML process in -pipe mode
+type pipeProc struct {
+	id     int
+	stdin  io.Writer
+	stdout *pipeReader
+
+	// Aborts the process, which closes the pipe we're reading from.
+	kill func()
+
+	// See WorkerPool.LogDiagrams
+	logDiagrams bool
+}
+
+// render pipes a normalized diagram to PlantUML and reads back pageCnt images
+//
+// reqID labels log lines, and is empty for warm-up diagrams. The process is
+// killed if it takes longer than timeout. Any error leaves the process in an
+// unknown state, so callers shouldn't reuse it.
+func (p *pipeProc) render(reqID, normalized string, pageCnt int, format pb.Format, timeout time.Duration) ([][]byte, error) {
+	tag := workerTag(p.id, reqID)
+	var timedOut int32
+	deadline := time.AfterFunc(timeout, func() {
+		glog.Errorf("%s aborting worker, diagram took over %s", tag, timeout)
+		atomic.StoreInt32(&timedOut, 1)
+		p.kill()
+	})
+	defer deadline.Stop()
+
+	if glog.V(2) {
+		fields := append([]interface{}{"pages", pageCnt, "format", formatLabel(format)}, diagramFields(normalized, p.logDiagrams)...)
+		glog.Infof("%s rendering: %s", tag, logFields(context.Background(), fields...))
+	}
+	fmt.Fprint(p.stdin, addFormatSpec(normalized, format))
+
+	res := make([][]byte, 0, pageCnt)
+	for len(res) < pageCnt {
+		page, err := p.stdout.next()
+		if err != nil {
+			if atomic.LoadInt32(&timedOut) == 1 {
+				return nil, status.Errorf(codes.DeadlineExceeded, "diagram took over %s to render", timeout)
+			}
+			return nil, fmt.Errorf("error reading diagram: %v", err)
+		}
+		res = append(res, page)
+		glog.V(2).Infof("%s read page: page=%d/%d bytes=%d", tag, len(res), pageCnt, len(page))
+	}
+	return res, nil
+}
+
+// warmUp renders WarmupDiagrams in every format before a worker takes requests
+//
+// A fresh JVM has to JIT-compile the rendering paths and load Graphviz, which
+// otherwise makes the first few real requests slow.
+func (wp *WorkerPool) warmUp(p *pipeProc) error {
+	if len(wp.WarmupDiagrams) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	for _, text := range wp.WarmupDiagrams {
+		// Warm up the engine that requests will get by default
+		if !wp.Graphviz() {
+			text = withLayout(text, pb.Layout_SMETANA)
+		}
+		normalized := normalizeText(text)
+		pageCnt, err := validate(normalized)
+		if err != nil {
+			return fmt.Errorf("invalid warm-up diagram: %w", err)
+		}
+		for _, format := range []pb.Format{pb.Format_PNG, pb.Format_SVG} {
+			// A cold JVM is much slower than RenderTimeout is tuned for.
+			_, err := p.render("", normalized, pageCnt, format, wp.RenderTimeout*warmupTimeoutFactor)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	elapsed := time.Since(start)
+	warmupDuration.Observe(elapsed.Seconds())
+	glog.Infof("[%d] warmed up in %s with %d diagram(s)", p.id, elapsed, len(wp.WarmupDiagrams))
+	return nil
+}
+
+const warmupTimeoutFactor = 3
+
+// checkWorkerPaths catches the most common broken installs before spawning Java
+func (wp *WorkerPool) checkWorkerPaths() error {
+	if _, err := exec.LookPath(wp.JavaExe); err != nil {
+		return fmt.Errorf("java executable %q not usable (set JavaExe / --java-path): %w", wp.JavaExe, err)
+	}
+	if wp.PlantUMLPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(wp.PlantUMLPath); err != nil {
+		return fmt.Errorf("plantuml jar %q not usable (set PlantUMLPath / --plantuml-path): %w", wp.PlantUMLPath, err)
+	}
+	return nil
+}
+
+const (
+	graphvizUnknown int32 = iota
+	graphvizFound
+	graphvizMissing
+)
+
+const graphvizCheckTimeout = time.Second * 5
+
+// checkGraphviz returns the path to a working dot, or "" if there isn't one
+//
+// Records the result for Graphviz(), logging when it changes to missing.
+func (wp *WorkerPool) checkGraphviz(id int) string {
+	name := wp.GraphvizDot
+	if name == "" {
+		name = "dot"
+	}
+	path, err := exec.LookPath(name)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), graphvizCheckTimeout)
+		defer cancel()
+		err = exec.CommandContext(ctx, path, "-V").Run()
+	}
+	if err != nil {
+		if atomic.SwapInt32(&wp.graphviz, graphvizMissing) != graphvizMissing {
+			glog.Warningf("[%d] graphviz %q unusable, defaulting to smetana layout: %v", id, name, err)
+		}
+		return ""
+	}
+	atomic.StoreInt32(&wp.graphviz, graphvizFound)
+	return path
+}
+
+// withLayout adds a layout pragma after every @startXYZ line
+//
+// Graphviz is PlantUML's default, so only other engines need one.
+func withLayout(text string, layout pb.Layout) string {
+	var pragma string
+	switch layout {
+	case pb.Layout_SMETANA:
+		pragma = "!pragma layout smetana"
+	case pb.Layout_ELK:
+		pragma = "!pragma layout elk"
+	default:
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	res := make([]string, 0, len(lines)+1)
+	for _, line := range lines {
+		res = append(res, line)
+		if strings.HasPrefix(strings.TrimSpace(line), "@start") {
+			res = append(res, pragma)
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+// withoutLayout removes pragmas added by withLayout, returning their layout
+//
+// Used on text extracted from images, to recover what was asked to render.
+func withoutLayout(text string) (string, pb.Layout) {
+	layout := pb.Layout_DEFAULT_LAYOUT
+	lines := strings.Split(text, "\n")
+	res := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if i > 0 && strings.HasPrefix(strings.TrimSpace(lines[i-1]), "@start") {
+			switch strings.TrimSpace(line) {
+			case "!pragma layout smetana":
+				layout = pb.Layout_SMETANA
+				continue
+			case "!pragma layout elk":
+				layout = pb.Layout_ELK
+				continue
+			}
+		}
+		res = append(res, line)
+	}
+	return strings.Join(res, "\n"), layout
+}
+
+// renderTimeout is the lesser of RenderTimeout and what's left of ctx's deadline
+func (wp *WorkerPool) renderTimeout(ctx context.Context) time.Duration {
+	timeout := wp.RenderTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < timeout {
+			timeout = left
+		}
+	}
+	return timeout
+}
+
+// How long a retiring worker has to exit after its stdin is closed.
+const workerStopGrace = time.Second * 5
+
+// recycleReason explains why a worker should be replaced, or "" if it's fine
+//
+// Only called between renders so that retiring never affects a request.
+func (wp *WorkerPool) recycleReason(pid int, renders int, started time.Time) string {
+	if wp.MaxWorkerRenders > 0 && renders >= wp.MaxWorkerRenders {
+		return fmt.Sprintf("reached max renders of %d", wp.MaxWorkerRenders)
+	}
+	if wp.MaxWorkerAge > 0 && time.Since(started) >= wp.MaxWorkerAge {
+		return fmt.Sprintf("reached max age of %s", wp.MaxWorkerAge)
+	}
+	if wp.MaxWorkerRSS > 0 {
+		rss, err := readRSS(pid)
+		if err != nil {
+			glog.Warningf("unable to read RSS of pid %d: %v", pid, err)
+			return ""
+		}
+		if rss >= wp.MaxWorkerRSS {
+			return fmt.Sprintf("RSS of %d bytes crossed max of %d", rss, wp.MaxWorkerRSS)
+		}
+	}
+	return ""
+}
+
+// stopProcess closes stdin so PlantUML can exit on its own, killing it after grace
+func stopProcess(id int, cmd *exec.Cmd, stdin io.Closer, grace time.Duration) {
+	stdin.Close()
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+
+	if grace > 0 {
+		select {
+		case <-done:
 			return
+		case <-time.After(grace):
+			glog.Warningf("[%d] java proc didn't exit within %s", id, grace)
 		}
 	}
+	if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		// Should only reach in exceptional cases
+		glog.Errorf("[%d] failed to kill java proc: %v", id, err)
+	}
+	<-done
 }
 
 func workerLogger(id int, stderr io.Reader) {
@@ -152,6 +512,27 @@ func workerLogger(id int, stderr io.Reader) {
 	}
 }
 
+// newPipeDelimiter returns a delimiter that user diagrams won't contain by chance
+//
+// Diagram text is embedded in rendered SVGs, so a diagram containing the
+// delimiter would split one image into two and shift every later response on
+// that worker.
+func newPipeDelimiter() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "PMLPROXY-" + hex.EncodeToString(b), nil
+}
+
+// checkDelimiter rejects diagrams that could desynchronise the pipe
+func checkDelimiter(s string, delim string) error {
+	if strings.Contains(s, delim) {
+		return status.Error(codes.InvalidArgument, "diagram contains the reserved pipe delimiter")
+	}
+	return nil
+}
+
 // normalizeText prepares a user-provided diagram for being piped into PlantUML
 func normalizeText(s string) string {
 	// Normalize newlines to UNIX
@@ -225,3 +606,23 @@ func validate(s string) (int, error) {
 	}
 	return startCount, nil
 }
+
+// splitDiagrams separates each @startXYZ/@endXYZ pair into its own diagram
+//
+// Assumes s has been normalized and validated. Text between pairs is dropped,
+// the same as PlantUML does.
+func splitDiagrams(s string) []string {
+	var diagrams []string
+	var cur []string
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, "@start") {
+			cur = nil
+		}
+		cur = append(cur, line)
+		if strings.HasPrefix(line, "@end") {
+			diagrams = append(diagrams, strings.Join(cur, "\n"))
+			cur = nil
+		}
+	}
+	return diagrams
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+
+	"github.com/coxley/pmlproxy/pb"
+)
+
+// Renderer turns diagram text into images, one per @startXYZ/@endXYZ pair
+//
+// Text is passed as the user provided it. Implementations are responsible for
+// normalizing and validating it, and must be safe for concurrent use.
+type Renderer interface {
+	Render(ctx context.Context, text string, format pb.Format) ([][]byte, error)
+}
+
+// RendererFunc allows plain functions to be used as a Renderer
+type RendererFunc func(ctx context.Context, text string, format pb.Format) ([][]byte, error)
+
+func (f RendererFunc) Render(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+	return f(ctx, text, format)
+}
+
+// Middleware wraps a Renderer with extra behaviour, eg: caching or retries
+type Middleware func(Renderer) Renderer
+
+// Chain wraps r with middleware, the first being the outermost
+func Chain(r Renderer, middleware ...Middleware) Renderer {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		r = middleware[i](r)
+	}
+	return r
+}
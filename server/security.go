@@ -0,0 +1,259 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SecurityPolicy limits what diagrams can read from the server and network
+//
+// Diagrams are checked before reaching PlantUML: every !include, !import,
+// !theme ... from, <img:...>, and %load_json() target must be the standard
+// library or under an allowed root. Targets built from variables are rejected
+// since they can't be checked up-front.
+//
+// Workers also run with PlantUML's own security profile, which catches
+// anything the text checks can't see.
+type SecurityPolicy struct {
+	// PlantUML security profile (default: ALLOWLIST)
+	//
+	// One of UNSECURE, LEGACY, SANDBOX, ALLOWLIST, or INTERNET. The allowlist
+	// below is passed along for ALLOWLIST.
+	Profile string
+
+	// Directories that include and image paths may be under
+	//
+	// Must be absolute, and can't be the filesystem root. See Validate.
+	Paths []string
+
+	// Directory PlantUML resolves relative paths from, normally the search path
+	//
+	// Relative paths are checked as if they were joined to it, so it should be
+	// one of Paths. Without it, relative paths are rejected. Workers run from
+	// this directory, since PlantUML looks in its working directory too.
+	IncludeDir string
+
+	// URL prefixes that includes and images may fetch, eg. https://host/dir/
+	URLs []string
+}
+
+// DefaultSecurityProfile is used when SecurityPolicy.Profile is empty
+const DefaultSecurityProfile = "ALLOWLIST"
+
+// Validate rejects roots that would open up the whole filesystem
+//
+// Relative roots, like ".", are rejected too: they depend on the working
+// directory, which is often "/" in containers. Invalid roots are ignored by
+// Check either way.
+func (p *SecurityPolicy) Validate() error {
+	if p.IncludeDir != "" {
+		if err := checkRoot(p.IncludeDir); err != nil {
+			return fmt.Errorf("include dir %v", err)
+		}
+	}
+	for _, root := range p.Paths {
+		if err := checkRoot(root); err != nil {
+			return fmt.Errorf("allowed path %v", err)
+		}
+	}
+	return nil
+}
+
+func checkRoot(root string) error {
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("%q must be absolute", root)
+	}
+	if clean := filepath.Clean(root); filepath.Dir(clean) == clean {
+		return fmt.Errorf("%q can't be the filesystem root", root)
+	}
+	return nil
+}
+
+// javaOptions are the system properties that configure PlantUML's profile
+//
+// Extra paths are allowed for PlantUML, but not in diagram text.
+func (p *SecurityPolicy) javaOptions(extraPaths ...string) []string {
+	profile := p.Profile
+	if profile == "" {
+		profile = DefaultSecurityProfile
+	}
+	opts := []string{"-DPLANTUML_SECURITY_PROFILE=" + strings.ToUpper(profile)}
+	if paths := append(append([]string{}, p.Paths...), extraPaths...); len(paths) > 0 {
+		opts = append(opts, "-Dplantuml.allowlist.path="+strings.Join(paths, string(os.PathListSeparator)))
+	}
+	if len(p.URLs) > 0 {
+		opts = append(opts, "-Dplantuml.allowlist.url="+strings.Join(p.URLs, ";"))
+	}
+	return opts
+}
+
+var (
+	// !include, !include_many, !include_once, !includesub, !includeurl, !includedef
+	includeDirective = regexp.MustCompile(`^!(include\w*|import)\s+(.*)$`)
+	themeDirective   = regexp.MustCompile(`^!theme\s+\S+\s+from\s+(.*)$`)
+	imgTag           = regexp.MustCompile(`<img[:\s]([^>{]*)`)
+	loadJSON         = regexp.MustCompile(`%load_json\(\s*([^,)]*)`)
+)
+
+// Check returns PermissionDenied for the first target outside the policy
+func (p *SecurityPolicy) Check(text string) error {
+	return p.check(text, nil)
+}
+
+// checkRequest is Check for a diagram and the files sent along with it
+//
+// Relative includes of those files are allowed. The diagram's are rewritten
+// to where the files are written, and PlantUML finds the files' own next to
+// the including file before looking anywhere else.
+func (p *SecurityPolicy) checkRequest(text string, files map[string]string) error {
+	names := make(map[string]bool, len(files))
+	for name := range files {
+		names[cleanFileName(name)] = true
+	}
+	sent := func(dir string) func(string) bool {
+		return func(target string) bool {
+			return names[cleanFileName(path.Join(dir, filepath.ToSlash(target)))]
+		}
+	}
+
+	if err := p.check(text, sent(".")); err != nil {
+		return err
+	}
+	for name, content := range files {
+		if err := p.check(content, sent(path.Dir(cleanFileName(name)))); err != nil {
+			return status.Errorf(codes.PermissionDenied, "%s: %s", name, status.Convert(err).Message())
+		}
+	}
+	return nil
+}
+
+// check is Check, also allowing relative paths that sent reports as request
+// files
+func (p *SecurityPolicy) check(text string, sent func(string) bool) error {
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		if m := includeDirective.FindStringSubmatch(line); m != nil {
+			// Only includes can name request files
+			allow := sent
+			if m[1] == "import" {
+				allow = nil
+			}
+			if err := p.checkTarget(m[2], allow); err != nil {
+				return status.Errorf(codes.PermissionDenied, "line %d: %v", i+1, err)
+			}
+		}
+
+		var targets []string
+		if m := themeDirective.FindStringSubmatch(line); m != nil {
+			targets = append(targets, m[1])
+		}
+		for _, m := range imgTag.FindAllStringSubmatch(line, -1) {
+			targets = append(targets, m[1])
+		}
+		for _, m := range loadJSON.FindAllStringSubmatch(line, -1) {
+			// Only literal strings can be checked
+			arg := strings.TrimSpace(m[1])
+			if len(arg) < 2 || arg[0] != '"' || arg[len(arg)-1] != '"' {
+				return status.Errorf(codes.PermissionDenied, "line %d: %%load_json must be given a literal string", i+1)
+			}
+			targets = append(targets, arg)
+		}
+
+		for _, target := range targets {
+			if err := p.checkTarget(target, nil); err != nil {
+				return status.Errorf(codes.PermissionDenied, "line %d: %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *SecurityPolicy) checkTarget(target string, sent func(string) bool) error {
+	target = strings.Trim(strings.TrimSpace(target), `"`)
+	if strings.ContainsAny(target, "$%") {
+		return fmt.Errorf("%q isn't a literal path or URL", target)
+	}
+
+	// Standard library, bundled in the jar
+	if strings.HasPrefix(target, "<") && strings.HasSuffix(target, ">") {
+		if strings.Contains(target, "..") {
+			return fmt.Errorf("%q climbs out of the standard library", target)
+		}
+		return nil
+	}
+
+	// Strip the sub-part of "file.puml!PART"
+	if i := strings.LastIndex(target, "!"); i > strings.LastIndex(target, "/") {
+		target = target[:i]
+	}
+
+	// Single-letter schemes are Windows drives
+	if u, err := url.Parse(target); err == nil && len(u.Scheme) > 1 {
+		if u.Scheme == "file" {
+			if u.Opaque != "" {
+				return p.checkPath(u.Opaque)
+			}
+			return p.checkPath(u.Path)
+		}
+		return p.checkURL(u)
+	}
+	if sent != nil && !filepath.IsAbs(target) && sent(target) {
+		return nil
+	}
+	return p.checkPath(target)
+}
+
+func (p *SecurityPolicy) checkPath(target string) error {
+	resolved := filepath.Clean(target)
+	if !filepath.IsAbs(target) {
+		if resolved == ".." || strings.HasPrefix(resolved, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%q climbs out of the include path", target)
+		}
+		if p.IncludeDir == "" || checkRoot(p.IncludeDir) != nil {
+			return fmt.Errorf("%q is relative, and there's no include path to resolve it from", target)
+		}
+		resolved = filepath.Join(p.IncludeDir, resolved)
+	}
+
+	for _, root := range p.Paths {
+		if checkRoot(root) != nil {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.Clean(root), resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q isn't under an allowed path", target)
+}
+
+func (p *SecurityPolicy) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q uses an unsupported scheme", u)
+	}
+	for _, prefix := range p.URLs {
+		allowed, err := url.Parse(prefix)
+		if err != nil {
+			continue
+		}
+		if allowed.Scheme != u.Scheme || !strings.EqualFold(allowed.Host, u.Host) {
+			continue
+		}
+		// Match whole path segments so /docs doesn't allow /docs-private
+		dir := strings.TrimSuffix(allowed.Path, "/")
+		clean := filepath.ToSlash(filepath.Clean("/" + u.Path))
+		if dir == "" || clean == dir || strings.HasPrefix(clean, dir+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q isn't under an allowed URL", u)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSecurityPolicyCheck(t *testing.T) {
+	p := &SecurityPolicy{
+		Paths:      []string{"/srv/diagrams"},
+		URLs:       []string{"https://example.com/shared/"},
+		IncludeDir: "/srv/diagrams",
+	}
+	table := []struct {
+		line    string
+		allowed bool
+	}{
+		{"rectangle Foo", true},
+		{"!include <C4/C4_Container>", true},
+		{"!include <../../etc/passwd>", false},
+		{"!include common.puml", true},
+		{"!include_once lib/common.puml!PART", true},
+		{"!include ../../etc/passwd", false},
+		{"!include diagrams/../../etc/passwd", false},
+		{"!include /srv/diagrams/common.puml", true},
+		{"!include /srv/diagrams/../../etc/passwd", false},
+		{"!include /etc/passwd", false},
+		{"!includesub /etc/passwd!BASIC", false},
+		{"!include file:///etc/passwd", false},
+		{"!include file:../../etc/passwd", false},
+		{"!include $path", false},
+		{"!import /tmp/plugin.zip", false},
+		{"!theme spacelab from /srv/diagrams/themes", true},
+		{"!theme spacelab from /tmp/themes", false},
+		{"!includeurl https://example.com/shared/lib.puml", true},
+		{"!include https://example.com/shared/../secret.puml", false},
+		{"!include https://example.com/shared-private/lib.puml", false},
+		{"!include https://example.com.evil.net/shared/lib.puml", false},
+		{"!include http://example.com/shared/lib.puml", false},
+		{"!include http://169.254.169.254/latest/meta-data", false},
+		{"!include ftp://example.com/shared/lib.puml", false},
+		{"rectangle \"<img:https://example.com/shared/logo.png>\"", true},
+		{"rectangle \"<img:/etc/hostname{scale=2}>\"", false},
+		{"rectangle \"<img /etc/hostname>\"", false},
+		{`!$data = %load_json("/srv/diagrams/data.json")`, true},
+		{`!$data = %load_json("/etc/passwd")`, false},
+		{`!$data = %load_json($file)`, false},
+	}
+	for _, tc := range table {
+		err := p.Check("@startuml\n" + tc.line + "\n@enduml")
+		if tc.allowed && err != nil {
+			t.Errorf("%s: expected to be allowed, got: %v", tc.line, err)
+		}
+		if !tc.allowed && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("%s: expected PermissionDenied, got: %v", tc.line, err)
+		}
+	}
+}
+
+func TestSecurityPolicyRelativePaths(t *testing.T) {
+	// PlantUML resolves relative paths from a directory that isn't allowed
+	p := &SecurityPolicy{Paths: []string{"/srv/diagrams"}, IncludeDir: "/etc"}
+	if err := p.Check("@startuml\n!include passwd\n@enduml"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected relative path outside the allowed paths to be denied, got: %v", err)
+	}
+
+	p = &SecurityPolicy{Paths: []string{"/srv/diagrams"}}
+	if err := p.Check("@startuml\n!include common.puml\n@enduml"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected relative path without an include dir to be denied, got: %v", err)
+	}
+
+	// Files sent with the request are found next to the including file
+	files := map[string]string{
+		"common.iuml":     "!include lib/colors.iuml",
+		"lib/colors.iuml": "!include ../common.iuml",
+	}
+	if err := p.checkRequest("@startuml\n!include common.iuml\n@enduml", files); err != nil {
+		t.Errorf("expected includes of request files to be allowed, got: %v", err)
+	}
+	files["lib/colors.iuml"] = "!include passwd"
+	if err := p.checkRequest("@startuml\n!include common.iuml\n@enduml", files); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected includes of other files to be denied, got: %v", err)
+	}
+}
+
+func TestSecurityPolicyValidate(t *testing.T) {
+	for _, tc := range []struct {
+		policy SecurityPolicy
+		valid  bool
+	}{
+		{SecurityPolicy{Paths: []string{"/srv/diagrams"}, IncludeDir: "/srv/diagrams"}, true},
+		{SecurityPolicy{Paths: []string{"/"}}, false},
+		{SecurityPolicy{Paths: []string{"/srv/.."}}, false},
+		{SecurityPolicy{Paths: []string{"."}}, false},
+		{SecurityPolicy{Paths: []string{"diagrams"}}, false},
+		{SecurityPolicy{IncludeDir: "/"}, false},
+	} {
+		if err := tc.policy.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%+v: expected valid=%v, got: %v", tc.policy, tc.valid, err)
+		}
+	}
+
+	// Ignored by Check, even without validating
+	p := &SecurityPolicy{Paths: []string{"/"}}
+	if err := p.Check("@startuml\n!include /etc/passwd\n@enduml"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected / not to allow anything, got: %v", err)
+	}
+}
+
+func TestSecurityJavaOptions(t *testing.T) {
+	p := &SecurityPolicy{URLs: []string{"https://a/", "https://b/"}}
+	got := strings.Join(p.javaOptions(), " ")
+	exp := "-DPLANTUML_SECURITY_PROFILE=ALLOWLIST -Dplantuml.allowlist.url=https://a/;https://b/"
+	if got != exp {
+		t.Errorf("expected %q, got %q", exp, got)
+	}
+}
+
+func TestSecurityRejectsBeforeRendering(t *testing.T) {
+	var called bool
+	h := &handler{
+		Renderer: RendererFunc(func(ctx context.Context, text string, format pb.Format) ([][]byte, error) {
+			called = true
+			return nil, nil
+		}),
+		Security: &SecurityPolicy{},
+	}
+	_, err := h.Render(context.Background(), &pb.RenderRequest{
+		Diagram: &pb.Diagram{Full: "@startuml\n!include /etc/passwd\n@enduml"},
+		Format:  pb.Format_SVG,
+	})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got: %v", err)
+	}
+	if called {
+		t.Errorf("expected renderer not to be called")
+	}
+}
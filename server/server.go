@@ -3,10 +3,13 @@ package server
 import (
 	"context"
 	"net"
+	"time"
 
 	"github.com/coxley/pmlproxy/pb"
 	"github.com/golang/glog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // Server wraps around our handler and gRPC server
@@ -14,14 +17,25 @@ import (
 // Handler can be used without the Server for applications that want more
 // control. To customize your gRPC server options, override MakeGRPC.
 // Server.ListenAndServe() will take care of registering it.
+//
+// The standard gRPC health service is registered alongside, reporting
+// NOT_SERVING until the handler has enough warm workers. The Admin service
+// isn't, see AdminHandler.
 type Server struct {
 	*grpc.Server // set by ListenAndServe
 	Handler      Handler
 	Addr         string
+	Health       *health.Server // set by ListenAndServe
 }
 
+// How often to check if the handler's readiness has changed
+var readinessInterval = time.Millisecond * 500
+
+// MakeGRPC creates the gRPC server used by ListenAndServe
+//
+// Overrides should keep RequestIDInterceptor, or logs won't have request IDs.
 var MakeGRPC = func() *grpc.Server {
-	return grpc.NewServer()
+	return grpc.NewServer(grpc.UnaryInterceptor(RequestIDInterceptor))
 }
 
 func (s *Server) ListenAndServe() error {
@@ -35,12 +49,43 @@ func (s *Server) ListenAndServe() error {
 	}
 	s.Server = MakeGRPC()
 	pb.RegisterPlantUMLServer(s.Server, s.Handler)
+	s.Health = health.NewServer()
+	s.Health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(s.Server, s.Health)
 
 	// Initialize workers and shut them down on-exit
 	ctx, cancel := context.WithCancel(context.Background())
 	go s.Handler.ManageWorkers(ctx)
+	go s.reportReadiness(ctx)
 	defer cancel()
 
 	glog.Infof("Starting server on %s", s.Addr)
 	return s.Server.Serve(lis)
 }
+
+// reportReadiness mirrors the handler's Ready(), if it has one, into the
+// health service
+func (s *Server) reportReadiness(ctx context.Context) {
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+
+	var ready bool
+	for {
+		if r := handlerReady(s.Handler); r != ready {
+			ready = r
+			if ready {
+				glog.Infof("server is ready")
+				s.Health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+			} else {
+				glog.Warningf("server is no longer ready")
+				s.Health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
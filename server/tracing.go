@@ -0,0 +1,42 @@
+package server
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+// tracer records spans with the global TracerProvider
+//
+// Spans are dropped until an application, like the daemon, sets one with
+// otel.SetTracerProvider. It's looked up on every call, since a Tracer kept
+// from before then only follows the first provider ever set.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/coxley/pmlproxy/server")
+}
+
+// Span attributes
+var (
+	attrFormat    = attribute.Key("pmlproxy.format")
+	attrLayout    = attribute.Key("pmlproxy.layout")
+	attrVersion   = attribute.Key("pmlproxy.version")
+	attrCacheKey  = attribute.Key("pmlproxy.cache.key")
+	attrTier      = attribute.Key("pmlproxy.cache.tier")
+	attrHit       = attribute.Key("pmlproxy.cache.hit")
+	attrResult    = attribute.Key("pmlproxy.cache.result")
+	attrPeer      = attribute.Key("pmlproxy.cache.peer")
+	attrWorker    = attribute.Key("pmlproxy.worker")
+	attrPages     = attribute.Key("pmlproxy.pages")
+	attrRequestID = attribute.Key("pmlproxy.request_id")
+)
+
+// endSpan marks span as failed if err is set, then ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, status.Convert(err).Message())
+	}
+	span.End()
+}
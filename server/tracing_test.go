@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coxley/pmlproxy/pb"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans sends spans to the returned recorder until the test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+	return rec
+}
+
+func TestRenderSpans(t *testing.T) {
+	rec := recordSpans(t)
+	h := fakeHandler(t)
+	h.Cache = NewLRUCache(1<<20, 0)
+
+	req := &pb.RenderRequest{Diagram: &pb.Diagram{Full: "@startuml\nrectangle Traced\n@enduml"}, Format: pb.Format_SVG}
+	if _, err := h.Render(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	// Each span's parent, showing where a slow render spent its time
+	for name, parent := range map[string]string{
+		"cache.get":       "Render",
+		"cache.fill":      "cache.get",
+		"queue.wait":      "cache.fill",
+		"plantuml.render": "cache.fill",
+	} {
+		s, ok := spans[name]
+		if !ok {
+			t.Errorf("expected a %s span, got %v", name, spans)
+			continue
+		}
+		if p := spans[parent]; p == nil || s.Parent().SpanID() != p.SpanContext().SpanID() {
+			t.Errorf("expected %s to be a child of %s", name, parent)
+		}
+	}
+}
+
+func TestPeerTracePropagation(t *testing.T) {
+	recordSpans(t)
+	opts := CachePoolOptions()
+
+	var got trace.SpanContext
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = trace.SpanContextFromContext(opts.Context(r))
+	}))
+	defer srv.Close()
+
+	ctx, span := tracer().Start(context.Background(), "test")
+	defer span.End()
+	httpReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := opts.Transport(ctx).RoundTrip(httpReq)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if !got.IsRemote() || got.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("expected peer to join trace %s, got %v", span.SpanContext().TraceID(), got)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/metadata"
+)
+
+// VersionHeader picks a PlantUML version when RenderRequest.Version is empty
+const VersionHeader = "plantuml-version"
+
+// requestVersion returns the version asked for by the request or its metadata
+func requestVersion(ctx context.Context, req *pb.RenderRequest) string {
+	if req.Version != "" {
+		return req.Version
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(VersionHeader); len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// sortedVersions returns the names of versions, oldest first
+func sortedVersions(versions map[string]*WorkerPool) []string {
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return compareVersions(names[i], names[j]) < 0
+	})
+	return names
+}
+
+// compareVersions orders names like "1.2022.7" by their numeric parts
+//
+// Anything that isn't a number separates parts, so "v1.2023.1" and
+// "plantuml-1.2023.1" compare as expected. Names with equal numbers fall back
+// to comparing as strings.
+func compareVersions(a, b string) int {
+	na, nb := versionParts(a), versionParts(b)
+	for i := 0; i < len(na) && i < len(nb); i++ {
+		if na[i] != nb[i] {
+			if na[i] < nb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(na) < len(nb):
+		return -1
+	case len(na) > len(nb):
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func versionParts(s string) []int {
+	var parts []int
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/coxley/pmlproxy/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestCompareVersions(t *testing.T) {
+	table := []struct {
+		a, b string
+		exp  int
+	}{
+		{"1.2022.7", "1.2022.7", 0},
+		{"1.2022.7", "1.2022.10", -1},
+		{"1.2023.1", "1.2022.10", 1},
+		{"v1.2023.1", "plantuml-1.2022.1", 1},
+		{"1.2022", "1.2022.1", -1},
+		{"old", "1.2022.1", -1},
+	}
+	for _, tc := range table {
+		if got := compareVersions(tc.a, tc.b); got != tc.exp {
+			t.Errorf("compareVersions(%q, %q): expected %d, got %d", tc.a, tc.b, tc.exp, got)
+		}
+	}
+}
+
+func TestVersions(t *testing.T) {
+	h := &handler{Versions: map[string]*WorkerPool{}}
+	for _, v := range []string{"1.2022.7", "1.2023.10", "1.2023.2"} {
+		wp := fakePool(t, "-fake-version", v)
+		runPool(t, wp)
+		h.Versions[v] = wp
+	}
+
+	text := "@startuml\nrectangle Foo\n@enduml"
+	table := []struct {
+		ctx       context.Context
+		version   string
+		expected  string
+		expectErr codes.Code
+	}{
+		{context.Background(), "", "1.2023.10", codes.OK},
+		{context.Background(), "1.2022.7", "1.2022.7", codes.OK},
+		{metadata.NewIncomingContext(context.Background(), metadata.Pairs(VersionHeader, "1.2023.2")), "", "1.2023.2", codes.OK},
+		{context.Background(), "0.1", "", codes.InvalidArgument},
+	}
+	for _, tc := range table {
+		res, err := h.Render(tc.ctx, &pb.RenderRequest{
+			Diagram: &pb.Diagram{Full: text},
+			Format:  pb.Format_SVG,
+			Version: tc.version,
+		})
+		if status.Code(err) != tc.expectErr {
+			t.Fatalf("version %q: expected %v, got: %v", tc.version, tc.expectErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if res.Version != tc.expected {
+			t.Errorf("version %q: expected response from %s, got %s", tc.version, tc.expected, res.Version)
+		}
+		if !strings.Contains(string(res.Data[0]), "version="+tc.expected) {
+			t.Errorf("version %q: expected image from %s, got: %s", tc.version, tc.expected, res.Data[0])
+		}
+	}
+
+	h.DefaultVersion = "1.2022.7"
+	res, err := h.Render(context.Background(), &pb.RenderRequest{
+		Diagram: &pb.Diagram{Full: text},
+		Format:  pb.Format_SVG,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Version != h.DefaultVersion {
+		t.Errorf("expected DefaultVersion %s, got %s", h.DefaultVersion, res.Version)
+	}
+}
+
+func TestVersionWithoutVersions(t *testing.T) {
+	h := &handler{Renderer: echoRenderer}
+	_, err := h.Render(context.Background(), &pb.RenderRequest{
+		Diagram: &pb.Diagram{Full: "@startuml\nrectangle Foo\n@enduml"},
+		Format:  pb.Format_SVG,
+		Version: "1.2022.7",
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got: %v", err)
+	}
+}